@@ -5,6 +5,9 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
 
 	kzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -14,26 +17,42 @@ import (
 )
 
 var (
-	masterURL       string
-	kubeconfig      string
-	watchNamespace  string
-	rancherURL      string
-	rancherHost     string
-	rancherPort     string
-	rancherUserName string
-	rancherPassword string
-	options         = kzap.Options{}
+	masterURL        string
+	kubeconfig       string
+	watchNamespace   string
+	rancherURL       string
+	rancherHost      string
+	rancherPort      string
+	rancherUserName  string
+	rancherPassword  string
+	clusterSources   string
+	mirrorNamespaces string
+	vaultCACertFile  string
+	options          = kzap.Options{}
+	controllerOpts   = controller.DefaultOptions()
 )
 
 func main() {
 	flag.Parse()
 	// initialize logs with verbosity-level and configurations
 	logs.InitLogs(options)
-	if rancherURL == "" || rancherUserName == "" || rancherPassword == "" {
+	controllerOpts.ClusterSources = strings.Split(clusterSources, ",")
+	controllerOpts.Vault.Token = os.Getenv("VAULT_TOKEN")
+	if vaultCACertFile != "" {
+		caCert, err := ioutil.ReadFile(vaultCACertFile)
+		if err != nil {
+			zap.S().Fatalf("Error reading the Vault CA certificate: %s", err.Error())
+		}
+		controllerOpts.Vault.CACert = caCert
+	}
+	if mirrorNamespaces != "" {
+		controllerOpts.MirrorNamespaces = strings.Split(mirrorNamespaces, ",")
+	}
+	if controllerOpts.HasClusterSource(controller.ClusterSourceRancher) && (rancherURL == "" || rancherUserName == "" || rancherPassword == "") {
 		zap.S().Fatalf("Rancher URL and/or credentials not specified!")
 	}
 	zap.S().Debugf("Creating new controller watching namespace %s.", watchNamespace)
-	newController, err := controller.NewController(kubeconfig, masterURL, watchNamespace, rancherURL, rancherHost, rancherPort, rancherUserName, rancherPassword)
+	newController, err := controller.NewController(kubeconfig, masterURL, watchNamespace, rancherURL, rancherHost, rancherPort, rancherUserName, rancherPassword, controllerOpts)
 	if err != nil {
 		zap.S().Fatalf("Error creating the controller: %s", err.Error())
 	}
@@ -51,5 +70,40 @@ func init() {
 	flag.StringVar(&rancherPort, "rancherPort", "", "Optional host port to access Rancher.")
 	flag.StringVar(&rancherUserName, "rancherUserName", "", "Rancher username.")
 	flag.StringVar(&rancherPassword, "rancherPassword", "", "Rancher password.")
+	flag.DurationVar(&controllerOpts.PollInterval, "rancherPollInterval", controllerOpts.PollInterval, "Interval to poll Rancher Server for cluster updates.")
+	flag.Float64Var(&controllerOpts.PollJitter, "rancherPollJitter", controllerOpts.PollJitter, "Maximum factor of the poll interval randomly added to each Rancher poll.")
+	flag.DurationVar(&controllerOpts.SyncRetryInterval, "syncRetryInterval", controllerOpts.SyncRetryInterval, "Initial backoff before a cluster that failed to sync is retried, doubling with each consecutive failure up to the poll interval. Other clusters keep syncing in the meantime.")
+	flag.IntVar(&controllerOpts.MetricsPort, "metricsPort", controllerOpts.MetricsPort, "Port serving the cluster sync and health probe metrics, and the summary of the last poll, at /debug/vars. Set to 0 to disable.")
+	flag.DurationVar(&controllerOpts.ResyncPeriod, "resyncPeriod", controllerOpts.ResyncPeriod, "Interval when informers are resynced.")
+	flag.BoolVar(&controllerOpts.DryRun, "dryRun", false, "Log a plan of intended changes instead of creating, updating or deleting resources.")
+	flag.BoolVar(&controllerOpts.ServerDryRun, "dryRunServer", false, "In dry-run mode, validate intended changes with server-side dry-run requests.")
+	flag.DurationVar(&controllerOpts.KubeconfigRotation.MaxAge, "kubeconfigMaxAge", controllerOpts.KubeconfigRotation.MaxAge, "Maximum age of the managed cluster kubeconfig credentials Rancher generates before they are rotated. Set to 0 to keep the stored credentials until they are missing or invalid. Kubeconfigs of other cluster sources are replaced as soon as they change.")
+	flag.DurationVar(&controllerOpts.KubeconfigRotation.Window, "kubeconfigRotationWindow", controllerOpts.KubeconfigRotation.Window, "Period before the maximum credential age during which each cluster's kubeconfig is rotated.")
+	flag.DurationVar(&controllerOpts.KubeconfigRotation.MinOverlap, "kubeconfigMinOverlap", controllerOpts.KubeconfigRotation.MinOverlap, "Minimum time superseded kubeconfig credentials remain valid after a rotation.")
+	flag.StringVar(&controllerOpts.KubeconfigMode, "kubeconfigMode", controllerOpts.KubeconfigMode, "Source of managed cluster kubeconfigs: 'rancher' stores the Rancher generated kubeconfig, 'serviceaccount' stores a kubeconfig of a service account that accesses the managed cluster directly.")
+	flag.BoolVar(&controllerOpts.ConfigurePrereqs, "configurePrereqs", controllerOpts.ConfigurePrereqs, "Apply the prerequisite bundle to managed clusters.")
+	flag.StringVar(&controllerOpts.PrereqsBundleDir, "prereqsBundleDir", "", "Directory of the prerequisite manifests applied to managed clusters. If not set, the built-in bundle of the verrazzano-system namespace, service account and RBAC is used.")
+	flag.StringVar(&controllerOpts.ServiceAccountRoleManifest, "serviceAccountRoleManifest", controllerOpts.ServiceAccountRoleManifest, "Manifest of the verrazzano-system ClusterRole bound to the service account created in managed clusters, deploy/role.yaml of this repository.")
+	flag.DurationVar(&controllerOpts.ProbeInterval, "probeInterval", controllerOpts.ProbeInterval, "Interval to probe the health of managed clusters through their stored kubeconfigs. Set to 0 to disable probing.")
+	flag.DurationVar(&controllerOpts.ProbeTimeout, "probeTimeout", controllerOpts.ProbeTimeout, "Timeout of each managed cluster health probe.")
+	flag.IntVar(&controllerOpts.ProbeConcurrency, "probeConcurrency", controllerOpts.ProbeConcurrency, "Maximum number of managed clusters probed at the same time.")
+	flag.StringVar(&clusterSources, "clusterSources", strings.Join(controllerOpts.ClusterSources, ","), "Comma separated inventories of managed clusters: 'rancher' discovers the clusters managed by Rancher Server, 'capi' discovers the Cluster API Cluster objects in the admin cluster, 'directory' discovers the kubeconfig files of kubeconfigDir, 'secrets' discovers the Secrets labelled verrazzano.io/kubeconfig-source=true.")
+	flag.StringVar(&mirrorNamespaces, "mirrorNamespaces", "", "Comma separated namespaces the kubeconfig secrets of managed clusters are copied into. The verrazzano.io/mirror-namespaces annotation of a VerrazzanoManagedCluster restricts its secret to a subset of these namespaces, other namespaces of the annotation are ignored.")
+	flag.StringVar(&controllerOpts.SecretBackend, "secretBackend", controllerOpts.SecretBackend, "Where managed cluster kubeconfigs are stored: 'kubernetes' keeps them in the VerrazzanoManagedCluster secrets, 'vault' keeps them in the KV version 2 secrets engine of HashiCorp Vault, the secrets only referencing them. The Vault token is read from the VAULT_TOKEN environment variable unless vaultTokenFile is set.")
+	flag.StringVar(&controllerOpts.Vault.Address, "vaultAddress", "", "URL of the Vault server of the 'vault' secret backend.")
+	flag.StringVar(&controllerOpts.Vault.TokenFile, "vaultTokenFile", "", "File holding the Vault token, read on every request.")
+	flag.StringVar(&controllerOpts.Vault.Mount, "vaultMount", controllerOpts.Vault.Mount, "Mount path of the Vault KV version 2 secrets engine.")
+	flag.StringVar(&controllerOpts.Vault.PathPrefix, "vaultPathPrefix", controllerOpts.Vault.PathPrefix, "Path under the Vault mount that kubeconfigs are stored at.")
+	flag.StringVar(&vaultCACertFile, "vaultCACertFile", "", "PEM file of the CA certificate of the Vault server. If not set, the system roots are used.")
+	flag.DurationVar(&controllerOpts.Vault.Timeout, "vaultTimeout", controllerOpts.Vault.Timeout, "Timeout of Vault requests.")
+	flag.StringVar(&controllerOpts.NamingConfig, "namingConfig", "", "YAML file of the Go templates naming and labelling the generated resources, with keys name, secretName, labels and annotations, and of the propagate rules copying cluster labels and annotations onto them. If not set, the resources are named after the clusters.")
+	flag.BoolVar(&controllerOpts.EnableWebhook, "enableWebhook", false, "Serve a validating webhook rejecting edits to the serverAddress, kubeconfigSecret and type of the generated VerrazzanoManagedClusters, unless annotated verrazzano.io/allow-manual-edit=true. The webhook certificates are generated on startup.")
+	flag.IntVar(&controllerOpts.Webhook.Port, "webhookPort", controllerOpts.Webhook.Port, "Port the validating webhook server listens on.")
+	flag.StringVar(&controllerOpts.Webhook.ServiceName, "webhookServiceName", controllerOpts.Webhook.ServiceName, "Name of the Service routing the API server to the validating webhook server.")
+	flag.StringVar(&controllerOpts.Webhook.ServiceNamespace, "webhookServiceNamespace", controllerOpts.Webhook.ServiceNamespace, "Namespace of the validating webhook Service.")
+	flag.StringVar(&controllerOpts.Webhook.OperatorUser, "operatorUser", controllerOpts.Webhook.OperatorUser, "User name of the operator, whose edits the validating webhook always allows.")
+	flag.BoolVar(&controllerOpts.InstallCRD, "installCRD", false, "Install the VerrazzanoManagedCluster CustomResourceDefinition, or upgrade an older one installed by the operator, and wait for it to be established before starting. A definition the operator didn't install is never changed. The operator refuses to start if an existing definition serves no API version it supports.")
+	flag.DurationVar(&controllerOpts.CRDEstablishTimeout, "crdEstablishTimeout", controllerOpts.CRDEstablishTimeout, "Timeout for the installed CustomResourceDefinition to become established.")
+	flag.StringVar(&controllerOpts.KubeconfigDir, "kubeconfigDir", "", "Directory of managed cluster kubeconfig files read by the 'directory' cluster source on every poll.")
 	options.BindFlags(flag.CommandLine)
 }
@@ -0,0 +1,107 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles discovery of managed clusters provisioned with Cluster API
+
+package capi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"go.uber.org/zap"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ClusterResource is the resource of Cluster API Cluster objects
+var ClusterResource = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+
+// Cluster API conventions for the kubeconfig secret of a cluster
+const (
+	kubeconfigSecretSuffix = "-kubeconfig"
+	kubeconfigSecretKey    = "value"
+)
+
+// Source is the cluster source of the Cluster API Cluster objects in the admin cluster
+type Source struct {
+	clusterLister cache.GenericLister
+	secretLister  corev1listers.SecretLister
+}
+
+// NewSource returns a cluster source listing Cluster objects and their kubeconfig secrets from the given listers
+func NewSource(clusterLister cache.GenericLister, secretLister corev1listers.SecretLister) *Source {
+	return &Source{clusterLister: clusterLister, secretLister: secretLister}
+}
+
+// Name identifies the source
+func (s *Source) Name() string {
+	return "capi"
+}
+
+// GetClusters returns the Cluster API clusters whose kubeconfig secret has been generated.  Clusters that are still
+// being provisioned are left out until their kubeconfig is available, clusters whose kubeconfig secret can't be read
+// are returned with the error.
+func (s *Source) GetClusters() ([]source.Cluster, error) {
+	objs, err := s.clusterLister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var clusters []source.Cluster
+	for _, obj := range objs {
+		capiCluster, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected Cluster API object of type %T", obj)
+		}
+		if capiCluster.GetDeletionTimestamp() != nil {
+			continue
+		}
+		secretName := capiCluster.GetName() + kubeconfigSecretSuffix
+		secret, err := s.secretLister.Secrets(capiCluster.GetNamespace()).Get(secretName)
+		if k8serrors.IsNotFound(err) {
+			zap.S().Debugf("Cluster API cluster %s/%s has no kubeconfig secret yet", capiCluster.GetNamespace(), capiCluster.GetName())
+			continue
+		}
+		var kubeconfig []byte
+		if err == nil {
+			kubeconfig = secret.Data[kubeconfigSecretKey]
+			if len(kubeconfig) == 0 {
+				err = fmt.Errorf("kubeconfig secret %s/%s has no %s key", secret.Namespace, secret.Name, kubeconfigSecretKey)
+			}
+		}
+
+		clusters = append(clusters, source.Cluster{
+			ID:                 string(capiCluster.GetUID()),
+			Name:               capiCluster.GetName(),
+			KubeConfigContents: string(kubeconfig),
+			ServerAddress:      getControlPlaneEndpoint(capiCluster),
+			Type:               getInfrastructureKind(capiCluster),
+			Labels:             capiCluster.GetLabels(),
+			Annotations:        capiCluster.GetAnnotations(),
+			Err:                err,
+		})
+	}
+	return clusters, nil
+}
+
+// get the host:port of the control plane endpoint of a Cluster API cluster
+func getControlPlaneEndpoint(capiCluster *unstructured.Unstructured) string {
+	host, _, _ := unstructured.NestedString(capiCluster.Object, "spec", "controlPlaneEndpoint", "host")
+	port, _, _ := unstructured.NestedInt64(capiCluster.Object, "spec", "controlPlaneEndpoint", "port")
+	if host == "" {
+		return ""
+	}
+	return host + ":" + strconv.FormatInt(port, 10)
+}
+
+// get the kind of the infrastructure provider of a Cluster API cluster, such as OCICluster
+func getInfrastructureKind(capiCluster *unstructured.Unstructured) string {
+	kind, _, _ := unstructured.NestedString(capiCluster.Object, "spec", "infrastructureRef", "kind")
+	return kind
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package capi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Returns a Cluster API cluster with the given control plane endpoint
+func newCAPICluster(name string, uid string, host string, port int64) *unstructured.Unstructured {
+	capiCluster := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cluster.x-k8s.io/v1beta1",
+		"kind":       "Cluster",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "clusters",
+			"uid":       uid,
+			"labels":    map[string]interface{}{"env": "test"},
+		},
+		"spec": map[string]interface{}{
+			"infrastructureRef": map[string]interface{}{"kind": "OCICluster", "name": name},
+		},
+	}}
+	if host != "" {
+		unstructured.SetNestedMap(capiCluster.Object, map[string]interface{}{"host": host, "port": port}, "spec", "controlPlaneEndpoint")
+	}
+	return capiCluster
+}
+
+// Returns listers backed by indexers containing the given objects
+func newListers(t *testing.T, capiClusters []*unstructured.Unstructured, secrets []*corev1.Secret) (cache.GenericLister, corev1listers.SecretLister) {
+	clusterIndexer := testutil.NewIndexer(t)
+	for _, capiCluster := range capiClusters {
+		if err := clusterIndexer.Add(capiCluster); err != nil {
+			t.Fatalf("unexpected error adding cluster to indexer: %v", err)
+		}
+	}
+	return cache.NewGenericLister(clusterIndexer, ClusterResource.GroupResource()), testutil.NewSecretLister(t, secrets...)
+}
+
+func TestGetClusters(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload1-kubeconfig", Namespace: "clusters"},
+		Data:       map[string][]byte{"value": []byte("kubeconfig1")},
+	}
+	clusterLister, secretLister := newListers(t,
+		[]*unstructured.Unstructured{newCAPICluster("workload1", "uid-1", "10.0.0.1", 6443), newCAPICluster("provisioning", "uid-2", "", 0)},
+		[]*corev1.Secret{secret})
+
+	clusters, err := NewSource(clusterLister, secretLister).GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []source.Cluster{{
+		ID:                 "uid-1",
+		Name:               "workload1",
+		KubeConfigContents: "kubeconfig1",
+		ServerAddress:      "10.0.0.1:6443",
+		Type:               "OCICluster",
+		Labels:             map[string]string{"env": "test"},
+	}}
+	if !reflect.DeepEqual(clusters, expected) {
+		t.Fatalf("expected %v, got %v", expected, clusters)
+	}
+}
+
+func TestGetClustersWithoutKubeconfigKey(t *testing.T) {
+	broken := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "workload1-kubeconfig", Namespace: "clusters"}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload2-kubeconfig", Namespace: "clusters"},
+		Data:       map[string][]byte{"value": []byte("kubeconfig2")},
+	}
+	clusterLister, secretLister := newListers(t,
+		[]*unstructured.Unstructured{newCAPICluster("workload1", "uid-1", "10.0.0.1", 6443), newCAPICluster("workload2", "uid-2", "10.0.0.2", 6443)},
+		[]*corev1.Secret{broken, secret})
+
+	clusters, err := NewSource(clusterLister, secretLister).GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected both clusters, got %v", clusters)
+	}
+	for _, cluster := range clusters {
+		if cluster.Name == "workload1" && cluster.Err == nil {
+			t.Fatalf("expected an error for a kubeconfig secret without a value")
+		}
+		if cluster.Name == "workload2" && (cluster.Err != nil || cluster.KubeConfigContents != "kubeconfig2") {
+			t.Fatalf("expected the other cluster not to be affected, got %v", cluster)
+		}
+	}
+}
@@ -7,12 +7,30 @@ import (
 	"time"
 )
 
-// ResyncPeriod is interval when informer is resynced
+// ResyncPeriod is the default interval when informer is resynced
 const ResyncPeriod = 30 * time.Second
 
-// RancherPollInterval is interval to poll Rancher Server for updates
+// RancherPollInterval is the default interval to poll Rancher Server for updates
 const RancherPollInterval = 30 * time.Second
 
+// RancherPollJitter is the default jitter factor applied to the Rancher poll interval
+const RancherPollJitter = 0.1
+
+// KubeconfigMaxAge is the default maximum age of the kubeconfig credentials minted for the operator
+const KubeconfigMaxAge = 24 * time.Hour
+
+// KubeconfigRotationWindow is the default period before the maximum credential age during which credentials are rotated
+const KubeconfigRotationWindow = 2 * time.Hour
+
+// KubeconfigMinOverlap is the default time superseded kubeconfig credentials remain valid after a rotation
+const KubeconfigMinOverlap = 10 * time.Minute
+
+// SyncRetryInterval is the default initial backoff before a cluster that failed to sync is retried
+const SyncRetryInterval = 5 * time.Second
+
+// MetricsPort is the default port serving the sync metrics
+const MetricsPort = 9090
+
 // DefaultNamespace is constant for the default namespace
 const DefaultNamespace = "default"
 
@@ -22,6 +40,21 @@ const ManagedClusterPrefix = "verrazzano-managed-cluster"
 // KubeconfigSecretKey is the constant for kubeconfig
 const KubeconfigSecretKey = "kubeconfig"
 
+// KubeconfigServerKey is the key of VerrazzanoManagedCluster secrets holding the API server URL of the kubeconfig
+const KubeconfigServerKey = "server"
+
+// KubeconfigCAKey is the key of VerrazzanoManagedCluster secrets holding the certificate authority data of the kubeconfig
+const KubeconfigCAKey = "ca.crt"
+
+// KubeconfigTokenKey is the key of VerrazzanoManagedCluster secrets holding the bearer token of the kubeconfig
+const KubeconfigTokenKey = "token"
+
+// KubeconfigClientCertKey is the key of VerrazzanoManagedCluster secrets holding the client certificate of the kubeconfig
+const KubeconfigClientCertKey = "client.crt"
+
+// KubeconfigClientKeyKey is the key of VerrazzanoManagedCluster secrets holding the client key of the kubeconfig
+const KubeconfigClientKeyKey = "client.key"
+
 // VerrazzanoGroup is the constant for the Verrazzano group
 const VerrazzanoGroup = "verrazzano.oracle.com"
 
@@ -30,3 +63,156 @@ const K8SAppLabel = "k8s-app"
 
 // VerrazzanoClusterLabel is the constant the verrazzano.cluster label
 const VerrazzanoClusterLabel = "verrazzano.cluster"
+
+// ResyncRequestedAnnotation is the annotation on a VerrazzanoManagedCluster that triggers an immediate resync
+const ResyncRequestedAnnotation = "verrazzano.io/resync-requested"
+
+// FieldManager is the field manager name used for server-side apply of resources owned by the operator
+const FieldManager = "verrazzano-cluster-operator"
+
+// ManagedClusterFinalizer is the finalizer the operator places on VerrazzanoManagedClusters so that it can clean up
+// before they are removed
+const ManagedClusterFinalizer = "verrazzano.io/managed-cluster"
+
+// RancherTokenAnnotation is the annotation on a kubeconfig secret recording the Rancher token embedded in the kubeconfig
+const RancherTokenAnnotation = "verrazzano.io/rancher-token"
+
+// KubeconfigRotatedAtAnnotation is the annotation on a kubeconfig secret recording when its credentials were issued
+const KubeconfigRotatedAtAnnotation = "verrazzano.io/kubeconfig-rotated-at"
+
+// KubeconfigNextRotationAnnotation is the annotation on a kubeconfig secret recording when its credentials are next rotated
+const KubeconfigNextRotationAnnotation = "verrazzano.io/kubeconfig-next-rotation"
+
+// SupersededTokenAnnotation is the annotation on a kubeconfig secret recording the Rancher token replaced by the last rotation
+const SupersededTokenAnnotation = "verrazzano.io/superseded-rancher-token"
+
+// SupersededTokenRevokeAfterAnnotation is the annotation on a kubeconfig secret recording when the superseded token is revoked
+const SupersededTokenRevokeAfterAnnotation = "verrazzano.io/superseded-rancher-token-revoke-after"
+
+// PrereqsBundleHashAnnotation is the annotation on a VerrazzanoManagedCluster recording the hash of the prerequisite
+// bundle last applied to the managed cluster
+const PrereqsBundleHashAnnotation = "verrazzano.io/prereqs-bundle-hash"
+
+// ServiceAccountHashAnnotation is the annotation on a VerrazzanoManagedCluster recording the hash of the service
+// account resources last applied to the managed cluster
+const ServiceAccountHashAnnotation = "verrazzano.io/service-account-hash"
+
+// ServiceAccountRoleManifest is the default path of the manifest of the ClusterRole bound to the service account
+// created in managed clusters, deploy/role.yaml is copied there in the operator image
+const ServiceAccountRoleManifest = "/etc/verrazzano-cluster-operator/role.yaml"
+
+// ProbeInterval is the default interval to probe the health of managed clusters
+const ProbeInterval = time.Minute
+
+// ProbeTimeout is the default timeout of a managed cluster health probe
+const ProbeTimeout = 10 * time.Second
+
+// ProbeConcurrency is the default maximum number of managed clusters probed at the same time
+const ProbeConcurrency = 10
+
+// HealthStatusAnnotation is the annotation on a VerrazzanoManagedCluster recording the result of the last health probe
+const HealthStatusAnnotation = "verrazzano.io/health-status"
+
+// KubernetesVersionAnnotation is the annotation on a VerrazzanoManagedCluster recording the Kubernetes version of the
+// managed cluster
+const KubernetesVersionAnnotation = "verrazzano.io/kubernetes-version"
+
+// ProbeLatencyAnnotation is the annotation on a VerrazzanoManagedCluster recording the duration of the last health probe
+const ProbeLatencyAnnotation = "verrazzano.io/probe-latency"
+
+// ProbeFailureReasonAnnotation is the annotation on a VerrazzanoManagedCluster recording why the last health probe failed
+const ProbeFailureReasonAnnotation = "verrazzano.io/probe-failure-reason"
+
+// LastProbeTimeAnnotation is the annotation on a VerrazzanoManagedCluster recording when it was last probed
+const LastProbeTimeAnnotation = "verrazzano.io/last-probe-time"
+
+// KubeconfigSourceLabel is the label marking Secrets whose kubeconfig describes a managed cluster
+const KubeconfigSourceLabel = "verrazzano.io/kubeconfig-source"
+
+// ClusterNameAnnotation is the annotation on a kubeconfig Secret overriding the managed cluster name
+const ClusterNameAnnotation = "verrazzano.io/cluster-name"
+
+// ClusterTypeAnnotation is the annotation on a kubeconfig Secret setting the managed cluster type
+const ClusterTypeAnnotation = "verrazzano.io/cluster-type"
+
+// RegisterInRancherAnnotation is the annotation on a user created VerrazzanoManagedCluster requesting the operator to
+// import the cluster of its kubeconfig secret into Rancher
+const RegisterInRancherAnnotation = "verrazzano.io/register-in-rancher"
+
+// RancherClusterIDAnnotation is the annotation on a VerrazzanoManagedCluster recording the ID of the cluster it was
+// imported as into Rancher
+const RancherClusterIDAnnotation = "verrazzano.io/rancher-cluster-id"
+
+// ClusterIDLabel is the label on VerrazzanoManagedClusters and their secrets recording the ID of the managed cluster in
+// its source.  Unlike the cluster name, the ID never changes.
+const ClusterIDLabel = "verrazzano.io/cluster-id"
+
+// GeneratedLabelsAnnotation is the annotation on VerrazzanoManagedClusters and their secrets listing the keys of the
+// labels set by the naming rules, so that labels no longer set are removed
+const GeneratedLabelsAnnotation = "verrazzano.io/generated-labels"
+
+// GeneratedAnnotationsAnnotation is the annotation on VerrazzanoManagedClusters and their secrets listing the keys of
+// the annotations set by the naming rules, so that annotations no longer set are removed
+const GeneratedAnnotationsAnnotation = "verrazzano.io/generated-annotations"
+
+// MirrorNamespacesAnnotation is the annotation on a VerrazzanoManagedCluster listing the comma separated namespaces its
+// kubeconfig secret is mirrored into.  Only the namespaces configured for the operator are allowed, others are ignored.
+const MirrorNamespacesAnnotation = "verrazzano.io/mirror-namespaces"
+
+// MirroredSecretLabel is the label on the copies of VerrazzanoManagedCluster secrets in other namespaces
+const MirroredSecretLabel = "verrazzano.io/mirrored-secret"
+
+// MirrorSourceAnnotation is the annotation on the copy of a VerrazzanoManagedCluster secret recording the
+// namespace/name of the secret it is a copy of.  Owner references can't cross namespaces, so the operator deletes
+// copies whose secret is gone.
+const MirrorSourceAnnotation = "verrazzano.io/mirror-source"
+
+// KubeconfigLocationAnnotation is the annotation on VerrazzanoManagedClusters and their secrets recording the location
+// of a kubeconfig stored in an external secret backend, in place of the kubeconfig in the secret data
+const KubeconfigLocationAnnotation = "verrazzano.io/kubeconfig-location"
+
+// KubeconfigChecksumAnnotation is the annotation on VerrazzanoManagedCluster secrets recording the sha256 checksum of
+// their kubeconfig, so that changes are detected without reading the kubeconfig or the external backend storing it
+const KubeconfigChecksumAnnotation = "verrazzano.io/kubeconfig-checksum"
+
+// VaultMount is the default mount path of the Vault KV version 2 secrets engine storing kubeconfigs
+const VaultMount = "secret"
+
+// VaultPathPrefix is the default path under the Vault mount that kubeconfigs are stored at
+const VaultPathPrefix = "verrazzano/managed-clusters"
+
+// VaultTimeout is the default timeout of Vault requests
+const VaultTimeout = 10 * time.Second
+
+// CRDRevisionAnnotation is the annotation on the VerrazzanoManagedCluster CustomResourceDefinition installed by the
+// operator recording the revision of its definition, so that a definition installed by a newer release is never
+// downgraded.  Definitions without the annotation were not installed by the operator and are never changed.
+const CRDRevisionAnnotation = "verrazzano.io/crd-revision"
+
+// CRDEstablishTimeout is the default timeout for an installed CustomResourceDefinition to become established
+const CRDEstablishTimeout = time.Minute
+
+// AllowManualEditAnnotation is the annotation on a VerrazzanoManagedCluster allowing users to edit the spec fields
+// owned by the operator, which are otherwise rejected by the validating webhook
+const AllowManualEditAnnotation = "verrazzano.io/allow-manual-edit"
+
+// WebhookPort is the default port of the validating webhook server
+const WebhookPort = 9443
+
+// WebhookServiceName is the default name of the Service routing the API server to the validating webhook server
+const WebhookServiceName = "verrazzano-cluster-operator-webhook"
+
+// OperatorUser is the default user name of the operator, its service account
+const OperatorUser = "system:serviceaccount:default:verrazzano-cluster-operator"
+
+// PausedAnnotation is the annotation on a VerrazzanoManagedCluster that, set to true, makes the operator leave the
+// resource and its secret alone and stop probing the managed cluster, such as during its maintenance
+const PausedAnnotation = "verrazzano.io/paused"
+
+// PinKubeconfigAnnotation is the annotation on a VerrazzanoManagedCluster that, set to true, keeps the stored
+// kubeconfig credentials instead of rotating them
+const PinKubeconfigAnnotation = "verrazzano.io/pin-kubeconfig"
+
+// ServerAddressOverrideAnnotation is the annotation on a VerrazzanoManagedCluster setting the server address of its
+// spec, and of its service account kubeconfig, in place of the address reported by the cluster source
+const ServerAddressOverrideAnnotation = "verrazzano.io/server-address-override"
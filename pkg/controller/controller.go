@@ -6,11 +6,25 @@ package controller
 import (
 	"bytes"
 	"errors"
+	"expvar"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/capi"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/health"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/kubeconfigs"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/managedclusters"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/naming"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/prereqs"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/rancher"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/secretbackend"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/serviceaccount"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/vmcapi"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/webhook"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
 	clientset "github.com/verrazzano/verrazzano-crd-generator/pkg/client/clientset/versioned"
 	clientsetscheme "github.com/verrazzano/verrazzano-crd-generator/pkg/client/clientset/versioned/scheme"
 	informers "github.com/verrazzano/verrazzano-crd-generator/pkg/client/informers/externalversions"
@@ -18,9 +32,16 @@ import (
 
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	extclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -29,10 +50,198 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 const controllerAgentName = "verrazzano-rancher-controller"
 
+// Sources of the kubeconfigs stored for managed clusters
+const (
+	// KubeconfigModeRancher stores the Rancher generated kubeconfig, which proxies through Rancher
+	KubeconfigModeRancher = "rancher"
+	// KubeconfigModeServiceAccount stores a kubeconfig of a service account that accesses the managed cluster directly
+	KubeconfigModeServiceAccount = "serviceaccount"
+)
+
+// Cluster sources feeding managed clusters to the controller
+const (
+	// ClusterSourceRancher discovers the clusters managed by Rancher Server
+	ClusterSourceRancher = "rancher"
+	// ClusterSourceCAPI discovers the Cluster API Cluster objects in the admin cluster
+	ClusterSourceCAPI = "capi"
+	// ClusterSourceDirectory discovers the kubeconfig files of a directory
+	ClusterSourceDirectory = "directory"
+	// ClusterSourceSecrets discovers the Secrets in the admin cluster labelled as managed cluster kubeconfigs
+	ClusterSourceSecrets = "secrets"
+)
+
+var clusterSourceNames = []string{ClusterSourceRancher, ClusterSourceCAPI, ClusterSourceDirectory, ClusterSourceSecrets}
+
+// Backends storing the kubeconfigs of managed clusters
+const (
+	// SecretBackendKubernetes keeps the kubeconfigs in the VerrazzanoManagedCluster secrets
+	SecretBackendKubernetes = "kubernetes"
+	// SecretBackendVault keeps the kubeconfigs in HashiCorp Vault, the secrets only reference them
+	SecretBackendVault = "vault"
+)
+
+// Options contains the runtime tunables of the controller
+type Options struct {
+	// ResyncPeriod is the interval when informers are resynced
+	ResyncPeriod time.Duration
+	// PollInterval is the interval to poll Rancher Server for updates
+	PollInterval time.Duration
+	// PollJitter is the maximum factor of PollInterval randomly added to each poll
+	PollJitter float64
+	// SyncRetryInterval is the initial backoff before a cluster that failed to sync is retried, doubling with each
+	// consecutive failure up to PollInterval
+	SyncRetryInterval time.Duration
+	// MetricsPort is the port serving the sync and probe metrics at /debug/vars, the metrics aren't served if zero
+	MetricsPort int
+	// DryRun logs a plan of intended changes instead of mutating the cluster
+	DryRun bool
+	// ServerDryRun validates the planned changes with server-side dry-run requests
+	ServerDryRun bool
+	// KubeconfigRotation is the rotation policy of kubeconfig secret credentials
+	KubeconfigRotation managedclusters.RotationPolicy
+	// KubeconfigMode is the source of the kubeconfigs stored for managed clusters
+	KubeconfigMode string
+	// ClusterSources are the inventories of managed clusters
+	ClusterSources []string
+	// KubeconfigDir is the directory of kubeconfig files read by the directory cluster source
+	KubeconfigDir string
+	// ConfigurePrereqs applies the prerequisite bundle to managed clusters, it is off unless enabled
+	ConfigurePrereqs bool
+	// PrereqsBundleDir is the directory of the prerequisite bundle manifests, the built-in bundle is used if not set
+	PrereqsBundleDir string
+	// ServiceAccountRoleManifest is the manifest of the verrazzano-system ClusterRole bound to the service account
+	// created in managed clusters, deploy/role.yaml
+	ServiceAccountRoleManifest string
+	// NamingConfig is the configuration file of the rules naming and labelling the generated resources, the resources
+	// are named after the clusters if not set
+	NamingConfig string
+	// SecretBackend is where the kubeconfigs of managed clusters are stored
+	SecretBackend string
+	// Vault configures the Vault secret backend
+	Vault secretbackend.VaultConfig
+	// EnableWebhook serves the validating webhook rejecting edits to the VerrazzanoManagedCluster fields owned by the
+	// operator
+	EnableWebhook bool
+	// Webhook configures the validating webhook server
+	Webhook webhook.Config
+	// InstallCRD installs or upgrades the VerrazzanoManagedCluster CustomResourceDefinition on startup
+	InstallCRD bool
+	// CRDEstablishTimeout is the timeout for the installed CustomResourceDefinition to become established
+	CRDEstablishTimeout time.Duration
+	// MirrorNamespaces are the namespaces the kubeconfig secrets of all managed clusters are copied into
+	MirrorNamespaces []string
+	// ProbeInterval is the interval to probe the health of managed clusters, probing is disabled if zero
+	ProbeInterval time.Duration
+	// ProbeTimeout is the timeout of each managed cluster health probe
+	ProbeTimeout time.Duration
+	// ProbeConcurrency is the maximum number of managed clusters probed at the same time
+	ProbeConcurrency int
+}
+
+// DefaultOptions returns the default controller options
+func DefaultOptions() Options {
+	return Options{
+		ResyncPeriod:               constants.ResyncPeriod,
+		PollInterval:               constants.RancherPollInterval,
+		PollJitter:                 constants.RancherPollJitter,
+		SyncRetryInterval:          constants.SyncRetryInterval,
+		MetricsPort:                constants.MetricsPort,
+		KubeconfigRotation:         managedclusters.RotationPolicy{MaxAge: constants.KubeconfigMaxAge, Window: constants.KubeconfigRotationWindow, MinOverlap: constants.KubeconfigMinOverlap},
+		KubeconfigMode:             KubeconfigModeRancher,
+		ClusterSources:             []string{ClusterSourceRancher},
+		SecretBackend:              SecretBackendKubernetes,
+		Vault:                      secretbackend.VaultConfig{Mount: constants.VaultMount, PathPrefix: constants.VaultPathPrefix, Timeout: constants.VaultTimeout},
+		CRDEstablishTimeout:        constants.CRDEstablishTimeout,
+		ServiceAccountRoleManifest: constants.ServiceAccountRoleManifest,
+		Webhook:                    webhook.Config{Port: constants.WebhookPort, ServiceName: constants.WebhookServiceName, ServiceNamespace: constants.DefaultNamespace, OperatorUser: constants.OperatorUser},
+		ProbeInterval:              constants.ProbeInterval,
+		ProbeTimeout:               constants.ProbeTimeout,
+		ProbeConcurrency:           constants.ProbeConcurrency,
+	}
+}
+
+// Validate checks that the options are usable
+func (o Options) Validate() error {
+	if o.ResyncPeriod < 0 {
+		return fmt.Errorf("resync period must not be negative, got %v", o.ResyncPeriod)
+	}
+	if o.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %v", o.PollInterval)
+	}
+	if o.PollJitter < 0 {
+		return fmt.Errorf("poll jitter must not be negative, got %v", o.PollJitter)
+	}
+	if o.SyncRetryInterval <= 0 {
+		return fmt.Errorf("sync retry interval must be positive, got %v", o.SyncRetryInterval)
+	}
+	if o.MetricsPort < 0 || o.MetricsPort > 65535 {
+		return fmt.Errorf("metrics port must be between 0 and 65535, got %d", o.MetricsPort)
+	}
+	if o.ProbeInterval < 0 {
+		return fmt.Errorf("probe interval must not be negative, got %v", o.ProbeInterval)
+	}
+	if o.ProbeTimeout <= 0 {
+		return fmt.Errorf("probe timeout must be positive, got %v", o.ProbeTimeout)
+	}
+	if o.ProbeConcurrency < 1 {
+		return fmt.Errorf("probe concurrency must be at least 1, got %d", o.ProbeConcurrency)
+	}
+	if o.ServerDryRun && !o.DryRun {
+		return errors.New("server-side dry-run requires dry-run mode")
+	}
+	if o.KubeconfigMode != KubeconfigModeRancher && o.KubeconfigMode != KubeconfigModeServiceAccount {
+		return fmt.Errorf("kubeconfig mode must be %s or %s, got %s", KubeconfigModeRancher, KubeconfigModeServiceAccount, o.KubeconfigMode)
+	}
+	if len(o.ClusterSources) == 0 {
+		return errors.New("at least one cluster source is required")
+	}
+	for _, clusterSource := range o.ClusterSources {
+		valid := false
+		for _, name := range clusterSourceNames {
+			valid = valid || clusterSource == name
+		}
+		if !valid {
+			return fmt.Errorf("cluster source must be one of %s, got %s", strings.Join(clusterSourceNames, ", "), clusterSource)
+		}
+	}
+	if o.SecretBackend != SecretBackendKubernetes && o.SecretBackend != SecretBackendVault {
+		return fmt.Errorf("secret backend must be %s or %s, got %s", SecretBackendKubernetes, SecretBackendVault, o.SecretBackend)
+	}
+	if o.EnableWebhook && (o.Webhook.Port <= 0 || o.Webhook.Port > 65535) {
+		return fmt.Errorf("webhook port must be between 1 and 65535, got %d", o.Webhook.Port)
+	}
+	if o.EnableWebhook && (o.Webhook.ServiceName == "" || o.Webhook.ServiceNamespace == "") {
+		return errors.New("the webhook requires a service name and namespace")
+	}
+	if o.InstallCRD && o.CRDEstablishTimeout <= 0 {
+		return fmt.Errorf("CRD establish timeout must be positive, got %v", o.CRDEstablishTimeout)
+	}
+	for _, namespace := range o.MirrorNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) != 0 {
+			return fmt.Errorf("invalid mirror namespace %s: %s", namespace, strings.Join(errs, ", "))
+		}
+	}
+	if o.HasClusterSource(ClusterSourceDirectory) && o.KubeconfigDir == "" {
+		return errors.New("the directory cluster source requires a kubeconfig directory")
+	}
+	return o.KubeconfigRotation.Validate()
+}
+
+// HasClusterSource returns true if the given cluster source is enabled
+func (o Options) HasClusterSource(name string) bool {
+	for _, clusterSource := range o.ClusterSources {
+		if clusterSource == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Controller is the primary controller structure
 type Controller struct {
 	kubeClientSet        kubernetes.Interface
@@ -44,21 +253,54 @@ type Controller struct {
 	secretInformer                   cache.SharedIndexInformer
 	verrazzanoManagedClusterLister   listers.VerrazzanoManagedClusterLister
 	verrazzanoManagedClusterInformer cache.SharedIndexInformer
+	capiClusterInformer              cache.SharedIndexInformer
 
 	// Rancher cluster
 	rancherConfig rancher.Config
 
+	// clusterSource is the inventory of managed clusters
+	clusterSource source.ClusterSource
+
+	// prereqsBundle is applied to managed clusters, if configured
+	prereqsBundle *prereqs.Bundle
+
+	// serviceAccountRules are the rules of the ClusterRole bound to the service account created in managed clusters,
+	// serviceAccountHash identifies the service account resources applied with them
+	serviceAccountRules []rbacv1.PolicyRule
+	serviceAccountHash  string
+
+	// namingRules name and label the resources generated for managed clusters
+	namingRules *naming.Rules
+
+	// secretBackend stores the kubeconfigs of managed clusters
+	secretBackend secretbackend.SecretBackend
+
 	// Misc
+	options        Options
 	watchNamespace string
 	stopCh         <-chan struct{}
 
+	// resyncCh requests an immediate poll of the cluster source
+	resyncCh chan struct{}
+
+	// registrationQueue holds the keys of the VerrazzanoManagedClusters to register in Rancher, registrations that
+	// fail are retried with a rate limited backoff
+	registrationQueue workqueue.RateLimitingInterface
+
+	// retries tracks the backoff of the clusters that failed to sync
+	retries *syncRetries
+
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
 }
 
 // NewController returns a new Super Domain Operator controller
-func NewController(kubeconfig string, masterURL string, watchNamespace string, rancherURL string, rancherHost string, rancherPort string, rancherUsername string, rancherPassword string) (*Controller, error) {
+func NewController(kubeconfig string, masterURL string, watchNamespace string, rancherURL string, rancherHost string, rancherPort string, rancherUsername string, rancherPassword string, options Options) (*Controller, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
 	//
 	// Instantiate connection and clients to local k8s cluster
 	//
@@ -86,6 +328,12 @@ func NewController(kubeconfig string, masterURL string, watchNamespace string, r
 		zap.S().Fatalf("Error building superdomain clientset: %v", err)
 	}
 
+	if options.InstallCRD {
+		if err = vmcapi.EnsureCRD(kubeExtClientSet, options.CRDEstablishTimeout); err != nil {
+			return nil, err
+		}
+	}
+
 	//
 	// Set up informers and listers for the local k8s cluster
 	//
@@ -93,35 +341,92 @@ func NewController(kubeconfig string, masterURL string, watchNamespace string, r
 	var superDomainInformerFactory informers.SharedInformerFactory
 	if watchNamespace == "" {
 		// Consider all namespaces if our namespace is left wide open our set to default
-		kubeInformerFactory = kubeinformers.NewSharedInformerFactory(kubeClientSet, constants.ResyncPeriod)
-		superDomainInformerFactory = informers.NewSharedInformerFactory(superDomainClientSet, constants.ResyncPeriod)
+		kubeInformerFactory = kubeinformers.NewSharedInformerFactory(kubeClientSet, options.ResyncPeriod)
+		superDomainInformerFactory = informers.NewSharedInformerFactory(superDomainClientSet, options.ResyncPeriod)
 
 	} else {
 		// Otherwise, restrict to a specific namespace
-		kubeInformerFactory = kubeinformers.NewFilteredSharedInformerFactory(kubeClientSet, constants.ResyncPeriod, watchNamespace, nil)
-		superDomainInformerFactory = informers.NewFilteredSharedInformerFactory(superDomainClientSet, constants.ResyncPeriod, watchNamespace, nil)
+		kubeInformerFactory = kubeinformers.NewFilteredSharedInformerFactory(kubeClientSet, options.ResyncPeriod, watchNamespace, nil)
+		superDomainInformerFactory = informers.NewFilteredSharedInformerFactory(superDomainClientSet, options.ResyncPeriod, watchNamespace, nil)
 	}
 	secretsInformer := kubeInformerFactory.Core().V1().Secrets()
 	verrazzanoManagedClusterInformer := superDomainInformerFactory.Verrazzano().V1beta1().VerrazzanoManagedClusters()
 
+	// Cluster API clusters are watched through the dynamic client, the Cluster API types are not compiled in
+	var dynamicInformerFactory dynamicinformer.DynamicSharedInformerFactory
+	var capiClusterInformer kubeinformers.GenericInformer
+	if options.HasClusterSource(ClusterSourceCAPI) {
+		zap.S().Debugw("Building dynamic client")
+		dynamicClient, err := dynamic.NewForConfig(cfg)
+		if err != nil {
+			zap.S().Fatalf("Error building dynamic client: %v", err)
+		}
+		dynamicInformerFactory = dynamicinformer.NewFilteredDynamicSharedInformerFactory(dynamicClient, options.ResyncPeriod, watchNamespace, nil)
+		capiClusterInformer = dynamicInformerFactory.ForResource(capi.ClusterResource)
+	}
+
 	clientsetscheme.AddToScheme(scheme.Scheme)
 	eventBroadcaster := record.NewBroadcaster()
 	eventBroadcaster.StartLogging(zap.S().Infof)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClientSet.CoreV1().Events("")})
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
+	// The service account rules are loaded from the same manifest that deploys the verrazzano-system ClusterRole
+	var serviceAccountRules []rbacv1.PolicyRule
+	var serviceAccountHash string
+	if options.KubeconfigMode == KubeconfigModeServiceAccount || (options.ConfigurePrereqs && options.PrereqsBundleDir == "") {
+		if serviceAccountRules, err = serviceaccount.LoadRules(options.ServiceAccountRoleManifest); err != nil {
+			return nil, fmt.Errorf("error loading service account rules: %v", err)
+		}
+		if serviceAccountHash, err = serviceaccount.Hash(serviceAccountRules); err != nil {
+			return nil, err
+		}
+	}
+
+	var prereqsBundle *prereqs.Bundle
+	if options.ConfigurePrereqs {
+		prereqsBundle, err = prereqs.LoadBundle(options.PrereqsBundleDir, serviceAccountRules)
+		if err != nil {
+			return nil, fmt.Errorf("error loading prerequisite bundle: %v", err)
+		}
+		zap.S().Infof("Loaded prerequisite bundle of %d manifests with hash %s", len(prereqsBundle.Manifests), prereqsBundle.Hash)
+	}
+
+	namingRules, err := naming.LoadRules(options.NamingConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error loading naming rules: %v", err)
+	}
+
+	var secretBackend secretbackend.SecretBackend = secretbackend.Kubernetes{}
+	if options.SecretBackend == SecretBackendVault {
+		if secretBackend, err = secretbackend.NewVault(options.Vault); err != nil {
+			return nil, fmt.Errorf("error configuring Vault secret backend: %v", err)
+		}
+	}
+
 	rancherConfig := rancher.Config{
-		URL:                      rancherURL,
-		Username:                 rancherUsername,
-		Password:                 rancherPassword,
-		NodeIP:                   rancherHost,
-		NodePort:                 rancherPort,
-		CertificateAuthorityData: managedclusters.GetRancherCACert(kubeClientSet),
+		URL:      rancherURL,
+		Username: rancherUsername,
+		Password: rancherPassword,
+		NodeIP:   rancherHost,
+		NodePort: rancherPort,
+	}
+	if options.HasClusterSource(ClusterSourceRancher) {
+		rancherConfig.CertificateAuthorityData = managedclusters.GetRancherCACert(kubeClientSet)
 	}
 
 	controller := &Controller{
 		rancherConfig:                    rancherConfig,
+		prereqsBundle:                    prereqsBundle,
+		serviceAccountRules:              serviceAccountRules,
+		serviceAccountHash:               serviceAccountHash,
+		namingRules:                      namingRules,
+		secretBackend:                    secretBackend,
+		options:                          options,
 		watchNamespace:                   watchNamespace,
+		resyncCh:                         make(chan struct{}, 1),
+		registrationQueue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "RancherRegistrations"),
+		retries:                          newSyncRetries(options.SyncRetryInterval, options.PollInterval),
 		kubeClientSet:                    kubeClientSet,
 		kubeExtClientSet:                 kubeExtClientSet,
 		superDomainClientSet:             superDomainClientSet,
@@ -132,12 +437,54 @@ func NewController(kubeconfig string, masterURL string, watchNamespace string, r
 		recorder:                         recorder,
 	}
 
+	var clusterSources []source.ClusterSource
+	if options.HasClusterSource(ClusterSourceRancher) {
+		rancherSource := rancher.NewSource(rancher.Rancher{}, &controller.rancherConfig)
+		rancherSource.SkipKubeconfig = controller.skipKubeconfig
+		clusterSources = append(clusterSources, rancherSource)
+	}
+	if capiClusterInformer != nil {
+		controller.capiClusterInformer = capiClusterInformer.Informer()
+		clusterSources = append(clusterSources, capi.NewSource(capiClusterInformer.Lister(), controller.secretLister))
+	}
+	if options.HasClusterSource(ClusterSourceDirectory) {
+		clusterSources = append(clusterSources, kubeconfigs.NewDirSource(options.KubeconfigDir))
+	}
+	if options.HasClusterSource(ClusterSourceSecrets) {
+		clusterSources = append(clusterSources, kubeconfigs.NewSecretSource(controller.secretLister))
+	}
+	controller.clusterSource = clusterSources[0]
+	if len(clusterSources) > 1 {
+		controller.clusterSource = source.NewMultiSource(clusterSources...)
+	}
+
 	// Set up signals so we handle the first shutdown signal gracefully
 	zap.S().Debugw("Setting up signals")
 	stopCh := make(chan struct{})
 
+	// The webhook is registered once its server is listening, its configuration trusts the newly generated CA
+	if options.EnableWebhook {
+		webhookServer, err := webhook.NewServer(options.Webhook)
+		if err != nil {
+			return nil, err
+		}
+		if err = webhookServer.Start(stopCh); err != nil {
+			return nil, fmt.Errorf("failed to serve the validating webhook: %v", err)
+		}
+		if err = webhookServer.Register(kubeClientSet); err != nil {
+			return nil, fmt.Errorf("failed to register the validating webhook: %v", err)
+		}
+	}
+
+	if options.MetricsPort > 0 {
+		startMetricsServer(options.MetricsPort, stopCh)
+	}
+
 	go kubeInformerFactory.Start(stopCh)
 	go superDomainInformerFactory.Start(stopCh)
+	if dynamicInformerFactory != nil {
+		go dynamicInformerFactory.Start(stopCh)
+	}
 
 	return controller, nil
 }
@@ -146,32 +493,74 @@ func NewController(kubeconfig string, masterURL string, watchNamespace string, r
 // as syncing informer caches and starting workers. It will block until stopCh
 // is closed, at which point it will shutdown the workqueue and wait for
 // workers to finish processing their current work items.
-//
 func (c *Controller) Run(threadiness int) error {
 	defer runtime.HandleCrash()
+	defer c.registrationQueue.ShutDown()
 
 	// Start the informer factories to begin populating the informer caches
 	zap.S().Infow("Starting Verrazzano Rancher controller")
 
 	// Wait for the caches to be synced before starting watchers
 	zap.S().Infow("Waiting for informer caches to sync")
-	if ok := cache.WaitForCacheSync(c.stopCh, c.secretInformer.HasSynced, c.verrazzanoManagedClusterInformer.HasSynced); !ok {
+	cacheSyncs := []cache.InformerSynced{c.secretInformer.HasSynced, c.verrazzanoManagedClusterInformer.HasSynced}
+	if c.capiClusterInformer != nil {
+		cacheSyncs = append(cacheSyncs, c.capiClusterInformer.HasSynced)
+	}
+	if ok := cache.WaitForCacheSync(c.stopCh, cacheSyncs...); !ok {
 		return errors.New("failed to wait for caches to sync")
 	}
 
 	zap.S().Infow("Starting watchers")
 
 	c.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc:    func(new interface{}) { c.processRancherSecret(new.(*corev1.Secret)) },
-		UpdateFunc: func(old, new interface{}) { c.processRancherSecret(new.(*corev1.Secret)) },
+		AddFunc:    func(new interface{}) { c.processSecret(new.(*corev1.Secret)) },
+		UpdateFunc: func(old, new interface{}) { c.processSecret(new.(*corev1.Secret)) },
+		DeleteFunc: func(old interface{}) {
+			if secret, ok := old.(*corev1.Secret); ok {
+				c.processKubeconfigSourceSecret(secret)
+			}
+		},
 	})
 
-	go c.startRancherWatcher(c.stopCh)
+	c.verrazzanoManagedClusterInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(new interface{}) { c.processVerrazzanoManagedCluster(new.(*v1beta1.VerrazzanoManagedCluster)) },
+		UpdateFunc: func(old, new interface{}) {
+			c.processVerrazzanoManagedClusterUpdate(old.(*v1beta1.VerrazzanoManagedCluster), new.(*v1beta1.VerrazzanoManagedCluster))
+		},
+	})
+
+	// Changes of Cluster API clusters are synced right away instead of waiting for the next poll
+	if c.capiClusterInformer != nil {
+		c.capiClusterInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(new interface{}) { c.requestResync() },
+			UpdateFunc: func(old, new interface{}) { c.requestResync() },
+			DeleteFunc: func(old interface{}) { c.requestResync() },
+		})
+	}
+
+	go c.startClusterWatcher(c.stopCh)
+	go wait.Until(c.runRegistrationWorker, time.Second, c.stopCh)
+	if c.options.ProbeInterval > 0 {
+		go c.startHealthProber(c.stopCh)
+	}
 
 	<-c.stopCh
 	return nil
 }
 
+// Handles an added or updated Secret
+func (c *Controller) processSecret(newSecret *corev1.Secret) {
+	c.processRancherSecret(newSecret)
+	c.processKubeconfigSourceSecret(newSecret)
+}
+
+// if a Secret labelled as a managed cluster kubeconfig changes, trigger an immediate poll of the secrets cluster source
+func (c *Controller) processKubeconfigSourceSecret(secret *corev1.Secret) {
+	if c.options.HasClusterSource(ClusterSourceSecrets) && secret.Labels[constants.KubeconfigSourceLabel] == "true" {
+		c.requestResync()
+	}
+}
+
 // if the secret cattle-system/tls-rancher-ingressis updated, update CertificateAuthorityData in rancherConfig
 func (c *Controller) processRancherSecret(newSecret *corev1.Secret) {
 	if newSecret.Name == rancher.TLSRancherIngressSecret &&
@@ -182,49 +571,740 @@ func (c *Controller) processRancherSecret(newSecret *corev1.Secret) {
 	}
 }
 
-// Start polling the Rancher Server for updates
-func (c *Controller) startRancherWatcher(<-chan struct{}) {
+// Handles an updated VerrazzanoManagedCluster, changes of the namespaces its kubeconfig secret is mirrored into are
+// synced right away
+func (c *Controller) processVerrazzanoManagedClusterUpdate(old *v1beta1.VerrazzanoManagedCluster, vmc *v1beta1.VerrazzanoManagedCluster) {
+	if old.Annotations[constants.MirrorNamespacesAnnotation] != vmc.Annotations[constants.MirrorNamespacesAnnotation] {
+		c.requestResync()
+	}
+	if c.reportOverrides(old, vmc) {
+		c.requestResync()
+	}
+	c.processVerrazzanoManagedCluster(vmc)
+}
+
+// Handles an added or updated VerrazzanoManagedCluster
+func (c *Controller) processVerrazzanoManagedCluster(vmc *v1beta1.VerrazzanoManagedCluster) {
+	if vmc.DeletionTimestamp != nil {
+		c.finalizeVerrazzanoManagedCluster(vmc)
+		return
+	}
+	c.processRegistrationRequest(vmc)
+	c.processResyncRequest(vmc)
+}
+
+// if a VerrazzanoManagedCluster carries the register-in-rancher annotation, queue the import of its cluster into
+// Rancher.  The import talks to Rancher and the managed cluster, so it is left to the registration worker instead of
+// holding up the informer.
+func (c *Controller) processRegistrationRequest(vmc *v1beta1.VerrazzanoManagedCluster) {
+	if !wantsRegistration(vmc) {
+		return
+	}
+	if !c.options.HasClusterSource(ClusterSourceRancher) || vmc.Namespace != constants.DefaultNamespace {
+		zap.S().Warnf("Ignoring Rancher registration request of VerrazzanoManagedCluster %s/%s, registration requires the Rancher cluster source and namespace %s", vmc.Namespace, vmc.Name, constants.DefaultNamespace)
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(vmc)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	c.registrationQueue.Add(key)
+}
+
+// Returns true if the VerrazzanoManagedCluster requests registration in Rancher and isn't registered yet
+func wantsRegistration(vmc *v1beta1.VerrazzanoManagedCluster) bool {
+	return vmc.DeletionTimestamp == nil && vmc.Annotations[constants.RegisterInRancherAnnotation] == "true" && vmc.Annotations[constants.RancherClusterIDAnnotation] == ""
+}
+
+// Processes queued Rancher registrations until the queue is shut down
+func (c *Controller) runRegistrationWorker() {
+	for c.processNextRegistration() {
+	}
+}
+
+// Processes the next queued Rancher registration, a failed registration is requeued with a rate limited backoff.
+// Returns false once the queue is shut down.
+func (c *Controller) processNextRegistration() bool {
+	item, shutdown := c.registrationQueue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.registrationQueue.Done(item)
+	key := item.(string)
+	if err := c.syncRegistration(key); err != nil {
+		zap.S().Errorf("Failed to register cluster of VerrazzanoManagedCluster %s in Rancher, retrying, for the reason (%v)", key, err)
+		c.registrationQueue.AddRateLimited(key)
+		return true
+	}
+	c.registrationQueue.Forget(key)
+	return true
+}
+
+// Imports the cluster of the queued VerrazzanoManagedCluster into Rancher, unless the request was withdrawn or
+// fulfilled in the meantime.  Once the Rancher agent has registered the cluster, the cluster watcher adopts the
+// VerrazzanoManagedCluster like the VerrazzanoManagedCluster of any other Rancher cluster.
+func (c *Controller) syncRegistration(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	vmc, err := c.verrazzanoManagedClusterLister.VerrazzanoManagedClusters(namespace).Get(name)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !wantsRegistration(vmc) {
+		return nil
+	}
+	zap.S().Infof("Registering cluster of VerrazzanoManagedCluster %s/%s in Rancher", vmc.Namespace, vmc.Name)
+	opts := c.managedClusterOptions()
+	clusterID, err := c.registerInRancher(vmc, opts)
+	if err != nil {
+		c.recorder.Eventf(vmc, corev1.EventTypeWarning, "RegistrationFailed", "Failed to register cluster in Rancher: %v", err)
+		return err
+	}
+	if opts.DryRun {
+		opts.Plan.Log()
+		return nil
+	}
+	if err = managedclusters.SetAnnotations(c.superDomainClientSet, vmc, map[string]string{constants.RancherClusterIDAnnotation: clusterID}, opts); err != nil {
+		return fmt.Errorf("failed to record Rancher cluster ID: %v", err)
+	}
+	c.recorder.Eventf(vmc, corev1.EventTypeNormal, "RegisteredInRancher", "Registered cluster in Rancher as %s", clusterID)
+	c.requestResync()
+	return nil
+}
+
+// Imports the cluster reached through the kubeconfig secret of a VerrazzanoManagedCluster into Rancher, and applies the
+// Rancher agent manifest to the cluster.  Returns the ID of the cluster in Rancher.
+func (c *Controller) registerInRancher(vmc *v1beta1.VerrazzanoManagedCluster, opts managedclusters.Options) (string, error) {
+	secret, err := c.secretLister.Secrets(vmc.Namespace).Get(vmc.Spec.KubeconfigSecret)
+	if err != nil {
+		return "", err
+	}
+	kubeconfig, err := managedclusters.ReadKubeconfig(c.secretBackend, secret)
+	if err != nil {
+		return "", err
+	}
+	if len(kubeconfig) == 0 {
+		return "", fmt.Errorf("kubeconfig secret %s/%s has no %s key", secret.Namespace, secret.Name, constants.KubeconfigSecretKey)
+	}
+	if opts.DryRun {
+		zap.S().Infow("Dry-run: skipping change", "action", managedclusters.ActionCreate, "kind", "RancherCluster", "name", vmc.Name)
+		opts.Plan.Add(managedclusters.Change{Action: managedclusters.ActionCreate, Kind: "RancherCluster", Name: vmc.Name})
+		return "", nil
+	}
+
+	clusterID, err := rancher.ImportCluster(rancher.Rancher{}, c.rancherConfig, vmc.Name, string(vmc.UID))
+	if err != nil {
+		return "", err
+	}
+	manifest, err := rancher.GetRegistrationManifest(rancher.Rancher{}, c.rancherConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+	bundle, err := prereqs.ParseBundle([]byte(manifest))
+	if err != nil {
+		return "", fmt.Errorf("error parsing Rancher agent manifest: %v", err)
+	}
+	dynamicClient, mapper, err := prereqs.NewClients(string(kubeconfig))
+	if err != nil {
+		return "", err
+	}
+	if err = prereqs.Apply(dynamicClient, mapper, bundle, false); err != nil {
+		return "", err
+	}
+	return clusterID, nil
+}
+
+// Cleans up after a VerrazzanoManagedCluster that is being deleted, then removes the operator's finalizer.  If the
+// cleanup fails the finalizer is left in place and the cleanup is retried when the informer resyncs.
+func (c *Controller) finalizeVerrazzanoManagedCluster(vmc *v1beta1.VerrazzanoManagedCluster) {
+	if !managedclusters.HasFinalizer(vmc) {
+		return
+	}
+	zap.S().Infof("Finalizing VerrazzanoManagedCluster %s/%s", vmc.Namespace, vmc.Name)
+	if err := c.cleanupManagedCluster(vmc); err != nil {
+		zap.S().Errorf("Failed to clean up VerrazzanoManagedCluster %s/%s, for the reason (%v)", vmc.Namespace, vmc.Name, err)
+		c.recorder.Eventf(vmc, corev1.EventTypeWarning, "CleanupFailed", "Failed to clean up managed cluster: %v", err)
+		return
+	}
+	if err := managedclusters.RemoveFinalizer(c.superDomainClientSet, vmc, c.managedClusterOptions()); err != nil {
+		zap.S().Errorf("Failed to remove finalizer from VerrazzanoManagedCluster %s/%s, for the reason (%v)", vmc.Namespace, vmc.Name, err)
+		return
+	}
+	c.recorder.Event(vmc, corev1.EventTypeNormal, "Finalized", "Managed cluster cleanup completed")
+}
+
+// Cleans up the resources held outside the admin cluster on behalf of a VerrazzanoManagedCluster, by revoking the
+// Rancher token of its kubeconfig and deleting the kubeconfig from an external secret backend.  The kubeconfig secret
+// itself is garbage collected through its owner reference.
+func (c *Controller) cleanupManagedCluster(vmc *v1beta1.VerrazzanoManagedCluster) error {
+	secret, err := c.secretLister.Secrets(vmc.Namespace).Get(vmc.Spec.KubeconfigSecret)
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	opts := c.managedClusterOptions()
+	if err = c.revokeToken(managedclusters.GetSecretTokenName(secret), opts); err != nil {
+		return err
+	}
+	if opts.DryRun || c.secretBackend == nil {
+		return nil
+	}
+	return c.secretBackend.Delete(secret)
+}
+
+// Revokes the Rancher token minted for a cluster that isn't synced, its kubeconfig is never stored
+func (c *Controller) revokeUnusedToken(cluster source.Cluster, opts managedclusters.Options) {
+	if err := c.revokeToken(cluster.TokenName, opts); err != nil {
+		zap.S().Errorf("Failed to revoke unused Rancher token for cluster %s, for the reason (%v)", cluster.Name, err)
+	}
+}
+
+// Revokes a Rancher token that is no longer used by any kubeconfig secret
+func (c *Controller) revokeToken(tokenName string, opts managedclusters.Options) error {
+	if tokenName == "" {
+		return nil
+	}
+	if opts.DryRun {
+		zap.S().Infow("Dry-run: skipping change", "action", managedclusters.ActionDelete, "kind", "RancherToken", "name", tokenName)
+		opts.Plan.Add(managedclusters.Change{Action: managedclusters.ActionDelete, Kind: "RancherToken", Name: tokenName})
+		return nil
+	}
+	zap.S().Infof("Revoking Rancher token '%s'", tokenName)
+	return rancher.DeleteToken(rancher.Rancher{}, c.rancherConfig, tokenName)
+}
+
+// if a VerrazzanoManagedCluster carries the resync-requested annotation, trigger an immediate poll and clear the annotation
+func (c *Controller) processResyncRequest(vmc *v1beta1.VerrazzanoManagedCluster) {
+	if _, ok := vmc.Annotations[constants.ResyncRequestedAnnotation]; !ok {
+		return
+	}
+	zap.S().Infof("Resync requested by VerrazzanoManagedCluster %s/%s", vmc.Namespace, vmc.Name)
+	c.requestResync()
+
+	// In dry-run mode the annotation is only planned to be cleared
+	opts := c.managedClusterOptions()
+	err := managedclusters.SetAnnotations(c.superDomainClientSet, vmc, map[string]string{constants.ResyncRequestedAnnotation: ""}, opts)
+	if err != nil {
+		zap.S().Errorf("Failed to clear annotation %s on VerrazzanoManagedCluster %s/%s, for the reason (%v)", constants.ResyncRequestedAnnotation, vmc.Namespace, vmc.Name, err)
+	}
+	if opts.DryRun {
+		opts.Plan.Log()
+	}
+}
+
+// requestResync wakes up the cluster watcher, coalescing requests made while one is already pending
+func (c *Controller) requestResync() {
+	select {
+	case c.resyncCh <- struct{}{}:
+	default:
+	}
+}
+
+// Start polling the cluster source for updates
+func (c *Controller) startClusterWatcher(stopCh <-chan struct{}) {
 	for {
-		clusters, err := rancher.GetClusters(rancher.Rancher{}, c.rancherConfig)
+		discovered, err := c.clusterSource.GetClusters()
+		var incomplete *source.IncompleteError
+		switch {
+		case err == nil:
+			c.syncClusters(discovered, time.Now(), true).report()
+		case errors.As(err, &incomplete):
+			// The clusters of the failed sources are kept, the clusters of the others are synced
+			zap.S().Errorf("Failed to get some managed clusters from %s: %v", c.clusterSource.Name(), err)
+			failedPolls.Add(1)
+			c.syncClusters(discovered, time.Now(), !incomplete.Unknown).report()
+		default:
+			zap.S().Errorf("Failed to get managed clusters from %s: %v", c.clusterSource.Name(), err)
+			failedPolls.Add(1)
+		}
+
+		// Check available clusters every jittered poll interval, or sooner if a resync is requested or a failed
+		// cluster is due to be retried
+		select {
+		case <-time.After(c.nextPollDelay(time.Now())):
+		case <-c.resyncCh:
+			zap.S().Infof("Resyncing %s on request.", c.clusterSource.Name())
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// Syncs the discovered clusters and prunes the deregistered ones, unless the discovered clusters may be incomplete.  A
+// cluster that fails to sync doesn't hold up the others, it is retried once its backoff elapses and its resources are
+// kept in the meantime.
+func (c *Controller) syncClusters(discovered []source.Cluster, now time.Time, prune bool) *syncSummary {
+	summary := newSyncSummary(c.clusterSource.Name(), now)
+	opts := c.managedClusterOptions()
+	clusters, conflicts, failures := c.namingRules.Resolve(discovered, c.getResourceOwners())
+	c.reportNameConflicts(conflicts)
+	for _, conflict := range conflicts {
+		for _, skipped := range conflict.Skipped {
+			c.revokeUnusedToken(skipped, opts)
+		}
+	}
+	for _, failure := range failures {
+		zap.S().Errorf("Skipping cluster '%s' with ID '%s', failed to apply the naming rules, for the reason (%v)", failure.Cluster.DisplayName, failure.Cluster.ID, failure.Err)
+		summary.failed(failure.Cluster.DisplayName, failure.Err)
+		c.revokeUnusedToken(failure.Cluster, opts)
+	}
+	for _, cluster := range clusters {
+		if !c.retries.due(cluster.ID, now) {
+			zap.S().Debugf("Deferring sync of Verrazzano Managed Cluster: Id='%s', Name='%s' until its retry backoff elapses", cluster.ID, cluster.Name)
+			summary.deferred(cluster.Name)
+			c.revokeUnusedToken(cluster, opts)
+			continue
+		}
+		zap.S().Infof("Syncing Verrazzano Managed Cluster: Id='%s', Name='%s'", cluster.ID, cluster.Name)
+
+		// Generate the resources to inform the Super Domain Operator about this cluster
+		err := cluster.Err
+		if err == nil {
+			err = c.generateSuperDomainOperatorResources(cluster, opts)
+		}
 		if err != nil {
-			zap.S().Errorf("Failed to get Rancher managed clusters: %v", err)
+			backoff := c.retries.failed(cluster.ID, now)
+			zap.S().Errorf("Failed to sync Verrazzano Managed Cluster: Id='%s', Name='%s', retrying in %v, for the reason (%v)", cluster.ID, cluster.Name, backoff, err)
+			summary.failed(cluster.Name, err)
+			// A failed sync never stores the kubeconfig generated for it
+			c.revokeUnusedToken(cluster, opts)
+			continue
+		}
+		c.retries.succeeded(cluster.ID)
+		summary.succeeded(cluster.Name)
+
+		zap.S().Infof("Successfully synced Verrazzano Managed Cluster: Id='%s', Name='%s'", cluster.ID, cluster.Name)
+	}
+	// Skipped and failed clusters are still registered, their resources must be kept
+	registered := clusters
+	for _, conflict := range conflicts {
+		registered = append(registered, conflict.Skipped...)
+	}
+	for _, failure := range failures {
+		registered = append(registered, failure.Cluster)
+	}
+	ids := map[string]bool{}
+	for _, cluster := range registered {
+		ids[cluster.ID] = true
+	}
+	c.retries.retain(ids)
+	if prune {
+		c.pruneDeregisteredClusters(registered, opts)
+	} else {
+		zap.S().Warnf("Clusters of %s may be missing, skipping removal of deregistered clusters", c.clusterSource.Name())
+	}
+	if err := managedclusters.SyncMirroredSecrets(c.kubeClientSet, c.secretLister, c.verrazzanoManagedClusterLister, c.options.MirrorNamespaces, opts); err != nil {
+		zap.S().Errorf("Failed to sync mirrored VerrazzanoManagedCluster Secrets, for the reason (%v)", err)
+	}
+	if opts.DryRun {
+		opts.Plan.Log()
+	}
+	return summary
+}
+
+// Returns the delay until the next poll, brought forward to when the first failed cluster is due to be retried
+func (c *Controller) nextPollDelay(now time.Time) time.Duration {
+	delay := wait.Jitter(c.options.PollInterval, c.options.PollJitter)
+	if next, ok := c.retries.nextRetry(); ok && next.Sub(now) < delay {
+		delay = next.Sub(now)
+	}
+	return delay
+}
+
+// Records events of the override annotations set or removed by an update of a VerrazzanoManagedCluster, returns true
+// if any changed
+func (c *Controller) reportOverrides(old *v1beta1.VerrazzanoManagedCluster, vmc *v1beta1.VerrazzanoManagedCluster) bool {
+	changed := false
+	if paused := managedclusters.IsPaused(vmc); paused != managedclusters.IsPaused(old) {
+		changed = true
+		if paused {
+			c.recorder.Event(vmc, corev1.EventTypeNormal, "Paused", "Reconciliation of the managed cluster is paused")
+		} else {
+			c.recorder.Event(vmc, corev1.EventTypeNormal, "Resumed", "Reconciliation of the managed cluster is resumed")
+		}
+	}
+	if pinned := managedclusters.IsKubeconfigPinned(vmc); pinned != managedclusters.IsKubeconfigPinned(old) {
+		changed = true
+		if pinned {
+			c.recorder.Event(vmc, corev1.EventTypeNormal, "KubeconfigPinned", "Managed cluster kubeconfig credentials are pinned and no longer rotated")
 		} else {
-			for _, cluster := range clusters {
-				zap.S().Infof("Syncing Verrazzano Managed Cluster: Id='%s', Name='%s'", cluster.ID, cluster.Name)
+			c.recorder.Event(vmc, corev1.EventTypeNormal, "KubeconfigUnpinned", "Managed cluster kubeconfig credentials are rotated again")
+		}
+	}
+	if address := managedclusters.GetServerAddressOverride(vmc); address != managedclusters.GetServerAddressOverride(old) {
+		changed = true
+		if address != "" {
+			c.recorder.Eventf(vmc, corev1.EventTypeNormal, "ServerAddressOverridden", "Managed cluster server address is overridden with %s", address)
+		} else {
+			c.recorder.Event(vmc, corev1.EventTypeNormal, "ServerAddressOverrideRemoved", "Managed cluster server address is no longer overridden")
+		}
+	}
+	return changed
+}
 
-				// Generate the resources to inform the Super Domain Operator about this cluster
-				c.generateSuperDomainOperatorResources(cluster)
+// Returns the cluster ID label values of the existing VerrazzanoManagedClusters by name
+func (c *Controller) getResourceOwners() map[string]string {
+	owners := map[string]string{}
+	selector := labels.SelectorFromSet(labels.Set{constants.K8SAppLabel: constants.VerrazzanoGroup})
+	vmcs, err := c.verrazzanoManagedClusterLister.VerrazzanoManagedClusters(constants.DefaultNamespace).List(selector)
+	if err != nil {
+		zap.S().Errorf("Failed to list VerrazzanoManagedClusters, for the reason (%v)", err)
+		return owners
+	}
+	for _, vmc := range vmcs {
+		owners[vmc.Name] = vmc.Labels[constants.ClusterIDLabel]
+	}
+	return owners
+}
 
-				zap.S().Infof("Successfully synced Verrazzano Managed Cluster: Id='%s', Name='%s'", cluster.ID, cluster.Name)
+// Reports the clusters left without resources because their names map to the resource name of another cluster
+func (c *Controller) reportNameConflicts(conflicts []naming.Conflict) {
+	for _, conflict := range conflicts {
+		for _, skipped := range conflict.Skipped {
+			zap.S().Errorf("Skipping cluster '%s' with ID '%s', its name maps to VerrazzanoManagedCluster '%s' of cluster '%s' with ID '%s'",
+				skipped.DisplayName, skipped.ID, conflict.Name, conflict.Owner.DisplayName, conflict.Owner.ID)
+			vmc, err := c.verrazzanoManagedClusterLister.VerrazzanoManagedClusters(constants.DefaultNamespace).Get(conflict.Name)
+			if err == nil {
+				c.recorder.Eventf(vmc, corev1.EventTypeWarning, "NameConflict", "Cluster '%s' with ID '%s' maps to the same name and was skipped", skipped.DisplayName, skipped.ID)
 			}
-			zap.S().Infow("Successfully synced Rancher.")
 		}
+	}
+}
+
+// Probe metrics published by expvar by VerrazzanoManagedCluster name, served at /debug/vars of the metrics port
+var (
+	probeLatency  = expvar.NewMap("cluster_probe_latency_seconds")
+	lastProbeTime = expvar.NewMap("cluster_probe_last_time")
+)
+
+// Start probing the health of managed clusters through their stored kubeconfigs
+func (c *Controller) startHealthProber(stopCh <-chan struct{}) {
+	wait.JitterUntil(func() { c.probeManagedClusters(health.Probe) }, c.options.ProbeInterval, c.options.PollJitter, true, stopCh)
+}
 
-		// Check available clusters every perdefined interval in seconds
-		<-time.After(constants.RancherPollInterval)
+// Probes the managed clusters of all VerrazzanoManagedClusters and records the results on them
+func (c *Controller) probeManagedClusters(probe health.ProbeFunc) {
+	selector := labels.SelectorFromSet(labels.Set{constants.K8SAppLabel: constants.VerrazzanoGroup})
+	vmcs, err := c.verrazzanoManagedClusterLister.VerrazzanoManagedClusters(constants.DefaultNamespace).List(selector)
+	if err != nil {
+		zap.S().Errorf("Failed to list VerrazzanoManagedClusters to probe, for the reason (%v)", err)
+		return
+	}
+
+	vmcsByName := map[string]*v1beta1.VerrazzanoManagedCluster{}
+	var targets []health.Target
+	for _, vmc := range vmcs {
+		if vmc.DeletionTimestamp != nil {
+			continue
+		}
+		if managedclusters.IsPaused(vmc) {
+			zap.S().Debugf("Skipping probe of paused VerrazzanoManagedCluster %s/%s", vmc.Namespace, vmc.Name)
+			continue
+		}
+		secret, err := c.secretLister.Secrets(vmc.Namespace).Get(vmc.Spec.KubeconfigSecret)
+		if err != nil {
+			zap.S().Debugf("Skipping probe of VerrazzanoManagedCluster %s/%s without kubeconfig secret, for the reason (%v)", vmc.Namespace, vmc.Name, err)
+			continue
+		}
+		kubeconfig, err := managedclusters.ReadKubeconfig(c.secretBackend, secret)
+		if err != nil {
+			zap.S().Errorf("Skipping probe of VerrazzanoManagedCluster %s/%s, failed to read its kubeconfig, for the reason (%v)", vmc.Namespace, vmc.Name, err)
+			continue
+		}
+		vmcsByName[vmc.Name] = vmc
+		targets = append(targets, health.Target{Name: vmc.Name, KubeconfigContents: string(kubeconfig)})
+	}
+
+	results := health.ProbeAll(targets, c.options.ProbeConcurrency, c.options.ProbeTimeout, probe)
+	publishProbeMetrics(results)
+	opts := c.managedClusterOptions()
+	for name, result := range results {
+		vmc := vmcsByName[name]
+		if result.Healthy {
+			zap.S().Debugf("Managed cluster %s is healthy, version %s, probed in %v", name, result.Version, result.Latency)
+		} else {
+			zap.S().Warnf("Managed cluster %s is unhealthy, for the reason (%s)", name, result.Reason)
+		}
+		if vmc.Annotations[constants.HealthStatusAnnotation] != result.Status() {
+			if result.Healthy {
+				c.recorder.Event(vmc, corev1.EventTypeNormal, "ClusterHealthy", "Managed cluster is healthy")
+			} else {
+				c.recorder.Eventf(vmc, corev1.EventTypeWarning, "ClusterUnhealthy", "Managed cluster is unhealthy: %s", result.Reason)
+			}
+		}
+		if err = managedclusters.SetAnnotations(c.superDomainClientSet, vmc, result.Annotations(), opts); err != nil {
+			zap.S().Errorf("Failed to record health of VerrazzanoManagedCluster %s/%s, for the reason (%v)", vmc.Namespace, vmc.Name, err)
+		}
+	}
+	if opts.DryRun {
+		opts.Plan.Log()
 	}
 }
 
-// Generates the resources used by the Super Domain Operator for the given cluster
-func (c *Controller) generateSuperDomainOperatorResources(cluster rancher.Cluster) {
+// Publishes the latency and time of the probes, and drops the metrics of clusters that are no longer probed
+func publishProbeMetrics(results map[string]health.Result) {
+	var stale []string
+	probeLatency.Do(func(kv expvar.KeyValue) {
+		if _, ok := results[kv.Key]; !ok {
+			stale = append(stale, kv.Key)
+		}
+	})
+	for _, name := range stale {
+		probeLatency.Delete(name)
+		lastProbeTime.Delete(name)
+	}
+	for name, result := range results {
+		latency := new(expvar.Float)
+		latency.Set(result.Latency.Seconds())
+		probeLatency.Set(name, latency)
+		probedAt := new(expvar.String)
+		probedAt.Set(result.ProbedAt.UTC().Format(time.RFC3339))
+		lastProbeTime.Set(name, probedAt)
+	}
+}
+
+// Returns the options used to create/update managed cluster resources during a single poll
+func (c *Controller) managedClusterOptions() managedclusters.Options {
+	opts := managedclusters.Options{
+		DryRun:       c.options.DryRun,
+		ServerDryRun: c.options.ServerDryRun,
+		Rotation:     c.options.KubeconfigRotation,
+		Backend:      c.secretBackend,
+	}
+	if opts.DryRun {
+		opts.Plan = &managedclusters.Plan{}
+	}
+	return opts
+}
+
+// Generates the resources used by the Super Domain Operator for the given cluster, returns an error if the cluster
+// failed to sync
+func (c *Controller) generateSuperDomainOperatorResources(cluster source.Cluster, opts managedclusters.Options) error {
 	/*********************
-	 * Create or Update VerrazzanoManagedClusters Secret if needed
+	 * Create or Update VerrazzanoManagedClusters if needed
 	 **********************/
-
-	err := managedclusters.CreateSecret(c.kubeClientSet, c.secretLister, cluster)
+	vmc, err := managedclusters.CreateVerrazzanoManagedCluster(c.superDomainClientSet, c.verrazzanoManagedClusterLister, cluster, opts)
 	if err != nil {
-		zap.S().Errorf("Failed to create/update VerrazzanoManagedCluster Secret for cluster %s, for the reason (%v)", cluster.Name, err)
+		return fmt.Errorf("failed to create/update VerrazzanoManagedCluster CR: %v", err)
+	}
+	if vmc.DeletionTimestamp != nil || managedclusters.IsPaused(vmc) {
+		// The VerrazzanoManagedCluster may have been paused or deleted after the kubeconfig was generated
+		if err = c.revokeToken(cluster.TokenName, opts); err != nil {
+			zap.S().Errorf("Failed to revoke unused Rancher token for cluster %s, for the reason (%v)", cluster.Name, err)
+		}
+		return nil
+	}
+
+	// Configure the prerequisites while the Rancher generated kubeconfig is at hand, it is needed to create CRDs
+	if err = c.configureClusterPrereqs(cluster, vmc, opts); err != nil {
+		c.recorder.Eventf(vmc, corev1.EventTypeWarning, "PrereqsFailed", "Failed to configure managed cluster prerequisites: %v", err)
+		return fmt.Errorf("failed to configure prerequisites: %v", err)
+	}
+
+	if c.options.KubeconfigMode == KubeconfigModeServiceAccount {
+		cluster, err = c.toServiceAccountKubeconfig(cluster, vmc, opts)
+		if err != nil {
+			return fmt.Errorf("failed to generate service account kubeconfig: %v", err)
+		}
 	}
 
 	/*********************
-	 * Create or Update VerrazzanoManagedClusters if needed
+	 * Create or Update VerrazzanoManagedClusters Secret, owned by the VerrazzanoManagedCluster, if needed
 	 **********************/
-	err = managedclusters.CreateVerrazzanoManagedCluster(c.superDomainClientSet, c.verrazzanoManagedClusterLister, cluster)
+	rotation, err := managedclusters.CreateSecret(c.kubeClientSet, c.secretLister, cluster, vmc, opts)
 	if err != nil {
-		zap.S().Errorf("Failed to create/update VerrazzanoManagedCluster CR for cluster %s, for the reason (%v)", cluster.Name, err)
+		return fmt.Errorf("failed to create/update VerrazzanoManagedCluster Secret: %v", err)
+	}
+	if rotation.Rotated {
+		c.recorder.Event(vmc, corev1.EventTypeNormal, "KubeconfigRotated", "Managed cluster kubeconfig credentials were rotated")
+	}
+
+	// Revoke tokens that were superseded, or generated but not stored
+	for _, tokenName := range rotation.RevokeTokens {
+		if err = c.revokeToken(tokenName, opts); err != nil {
+			zap.S().Errorf("Failed to revoke unused Rancher token for cluster %s, for the reason (%v)", cluster.Name, err)
+		}
+	}
+
+	// Now that the resources named after the current cluster name exist, retire those named after a previous name
+	c.retireRenamedClusters(cluster, vmc, opts)
+	return nil
+}
+
+// Deletes the VerrazzanoManagedClusters and secrets named after a previous name of a renamed cluster
+func (c *Controller) retireRenamedClusters(cluster source.Cluster, vmc *v1beta1.VerrazzanoManagedCluster, opts managedclusters.Options) {
+	renamed, err := managedclusters.GetRenamedVerrazzanoManagedClusters(c.verrazzanoManagedClusterLister, cluster)
+	if err != nil {
+		zap.S().Errorf("Failed to look up VerrazzanoManagedClusters of renamed cluster %s, for the reason (%v)", cluster.Name, err)
+		return
+	}
+	for _, previous := range renamed {
+		zap.S().Infof("Cluster %s was renamed from %s, retiring VerrazzanoManagedCluster '%s'", cluster.Name, previous.Labels[constants.VerrazzanoClusterLabel], previous.Name)
+		if err = managedclusters.RetireVerrazzanoManagedCluster(c.superDomainClientSet, c.kubeClientSet, previous, opts); err != nil {
+			zap.S().Errorf("Failed to retire VerrazzanoManagedCluster '%s' of renamed cluster %s, for the reason (%v)", previous.Name, cluster.Name, err)
+			continue
+		}
+		c.recorder.Eventf(vmc, corev1.EventTypeNormal, "ClusterRenamed", "Cluster was renamed from %s", previous.Name)
 	}
 }
 
-// Configures cluster prereqs via the Rancher API
-func (c *Controller) configureClusterPrereqs(cluster rancher.Cluster) {
+// Replaces the Rancher generated kubeconfig of the cluster with a kubeconfig of a service account that accesses the
+// managed cluster's API server directly.  The Rancher generated kubeconfig is used to bootstrap the service account,
+// which is skipped while the stored service account kubeconfig is valid and the applied resources are current.
+func (c *Controller) toServiceAccountKubeconfig(cluster source.Cluster, vmc *v1beta1.VerrazzanoManagedCluster, opts managedclusters.Options) (source.Cluster, error) {
+	if kubeconfig, err := c.getBootstrappedKubeconfig(cluster, vmc); err == nil {
+		zap.S().Debugf("Service account kubeconfig of cluster %s is valid, skipping bootstrap", cluster.Name)
+		if revokeErr := c.revokeToken(cluster.TokenName, opts); revokeErr != nil {
+			zap.S().Errorf("Failed to revoke unused Rancher token for cluster %s, for the reason (%v)", cluster.Name, revokeErr)
+		}
+		cluster.KubeConfigContents = kubeconfig
+		cluster.TokenName = ""
+		return cluster, nil
+	} else if cluster.KubeConfigContents == "" {
+		return cluster, fmt.Errorf("no kubeconfig to bootstrap the service account: %v", err)
+	}
+
+	managedClientSet, err := serviceaccount.NewClientSet(cluster.KubeConfigContents)
+	if err != nil {
+		return cluster, err
+	}
+	kubeconfig, err := serviceaccount.GenerateKubeconfig(managedClientSet, c.serviceAccountRules, getServerAddress(cluster, vmc), opts.DryRun)
+
+	// The Rancher token is only needed to bootstrap the service account
+	if revokeErr := c.revokeToken(cluster.TokenName, opts); revokeErr != nil {
+		zap.S().Errorf("Failed to revoke bootstrap Rancher token for cluster %s, for the reason (%v)", cluster.Name, revokeErr)
+	}
+	if errors.Is(err, serviceaccount.ErrNotBootstrapped) {
+		opts.Plan.Add(managedclusters.Change{Action: managedclusters.ActionCreate, Kind: "ServiceAccount", Namespace: serviceaccount.Namespace, Name: serviceaccount.Name, Diff: err.Error()})
+	}
+	if err != nil {
+		return cluster, err
+	}
+	if err = managedclusters.SetAnnotations(c.superDomainClientSet, vmc, map[string]string{constants.ServiceAccountHashAnnotation: c.serviceAccountHash}, opts); err != nil {
+		return cluster, err
+	}
+	cluster.KubeConfigContents = kubeconfig
+	cluster.TokenName = ""
+	return cluster, nil
+}
+
+// Returns true if no Rancher kubeconfig is needed to sync the cluster, so that no Rancher token is minted for it.  That
+// is the case while its sync is deferred, while its VerrazzanoManagedCluster is paused or being deleted, and while its
+// stored kubeconfig is current.
+func (c *Controller) skipKubeconfig(cluster source.Cluster) bool {
+	// A cluster whose retry backoff hasn't elapsed isn't synced by this poll
+	if !c.retries.due(cluster.ID, time.Now()) {
+		return true
+	}
+	vmc, err := managedclusters.FindVerrazzanoManagedCluster(c.verrazzanoManagedClusterLister, cluster)
+	if err != nil {
+		return false
+	}
+	if vmc.DeletionTimestamp != nil || managedclusters.IsPaused(vmc) {
+		return true
+	}
+	if c.options.KubeconfigMode == KubeconfigModeServiceAccount {
+		_, err = c.getBootstrappedKubeconfig(cluster, vmc)
+		return err == nil
+	}
+	return c.hasCurrentKubeconfig(cluster, vmc)
+}
+
+// Returns true if the stored Rancher kubeconfig of the cluster is kept by the rotation policy and the prerequisites
+// applied to the cluster are current, in which case no new Rancher kubeconfig is needed
+func (c *Controller) hasCurrentKubeconfig(cluster source.Cluster, vmc *v1beta1.VerrazzanoManagedCluster) bool {
+	if c.prereqsBundle != nil && vmc.Annotations[constants.PrereqsBundleHashAnnotation] != c.prereqsBundle.Hash {
+		return false
+	}
+	secret, err := c.secretLister.Secrets(vmc.Namespace).Get(vmc.Spec.KubeconfigSecret)
+	if err != nil {
+		return false
+	}
+	return managedclusters.IsKubeconfigCurrent(c.secretBackend, secret, cluster, c.options.KubeconfigRotation, managedclusters.IsKubeconfigPinned(vmc), time.Now())
+}
+
+// Returns the stored service account kubeconfig of the cluster, or an error unless it still authenticates against the
+// managed cluster and the prerequisites and service account resources applied to the cluster are current
+func (c *Controller) getBootstrappedKubeconfig(cluster source.Cluster, vmc *v1beta1.VerrazzanoManagedCluster) (string, error) {
+	if c.prereqsBundle != nil && vmc.Annotations[constants.PrereqsBundleHashAnnotation] != c.prereqsBundle.Hash {
+		return "", errors.New("prerequisite bundle changed")
+	}
+	if vmc.Annotations[constants.ServiceAccountHashAnnotation] != c.serviceAccountHash {
+		return "", errors.New("service account resources changed")
+	}
+	secret, err := managedclusters.FindSecretByClusterID(c.secretLister, cluster)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil {
+		return "", errors.New("no kubeconfig stored")
+	}
+	kubeconfig, err := managedclusters.ReadKubeconfig(c.secretBackend, secret)
+	if err != nil {
+		return "", err
+	}
+	if err = serviceaccount.CheckKubeconfig(string(kubeconfig), getServerAddress(cluster, vmc)); err != nil {
+		return "", err
+	}
+	return string(kubeconfig), nil
+}
+
+// Returns the server address of the cluster, or the address its VerrazzanoManagedCluster is annotated with
+func getServerAddress(cluster source.Cluster, vmc *v1beta1.VerrazzanoManagedCluster) string {
+	if address := managedclusters.GetServerAddressOverride(vmc); address != "" {
+		return address
+	}
+	return cluster.ServerAddress
+}
+
+// Deletes the VerrazzanoManagedClusters of clusters that are no longer in the cluster source
+func (c *Controller) pruneDeregisteredClusters(clusters []source.Cluster, opts managedclusters.Options) {
+	// An empty inventory is treated as suspect, Rancher for one always reports at least its local cluster
+	if len(clusters) == 0 {
+		zap.S().Warnf("%s returned no clusters, skipping removal of deregistered clusters", c.clusterSource.Name())
+		return
+	}
+	pruned, err := managedclusters.PruneVerrazzanoManagedClusters(c.superDomainClientSet, c.verrazzanoManagedClusterLister, clusters, opts)
+	if err != nil {
+		zap.S().Errorf("Failed to delete VerrazzanoManagedClusters of deregistered clusters, for the reason (%v)", err)
+	}
+	for _, name := range pruned {
+		zap.S().Infof("Deleted VerrazzanoManagedCluster '%s' of deregistered cluster", name)
+	}
+}
+
+// Applies the prerequisite bundle to a managed cluster using the Rancher generated kubeconfig, unless the bundle with
+// the same hash was applied before.  The hash of the applied bundle is recorded on the VerrazzanoManagedCluster.
+func (c *Controller) configureClusterPrereqs(cluster source.Cluster, vmc *v1beta1.VerrazzanoManagedCluster, opts managedclusters.Options) error {
+	if c.prereqsBundle == nil || vmc.Annotations[constants.PrereqsBundleHashAnnotation] == c.prereqsBundle.Hash {
+		return nil
+	}
+	zap.S().Infof("Applying prerequisite bundle %s to cluster %s", c.prereqsBundle.Hash, cluster.Name)
+	if opts.DryRun {
+		zap.S().Infow("Dry-run: skipping change", "action", managedclusters.ActionUpdate, "kind", "PrereqsBundle", "name", cluster.Name)
+		opts.Plan.Add(managedclusters.Change{Action: managedclusters.ActionUpdate, Kind: "PrereqsBundle", Name: cluster.Name, Diff: c.prereqsBundle.Hash})
+		if !opts.ServerDryRun {
+			return nil
+		}
+	}
+	dynamicClient, mapper, err := prereqs.NewClients(cluster.KubeConfigContents)
+	if err != nil {
+		return err
+	}
+	if err = prereqs.Apply(dynamicClient, mapper, c.prereqsBundle, opts.ServerDryRun); err != nil {
+		return err
+	}
+	if opts.DryRun {
+		return nil
+	}
+	c.recorder.Eventf(vmc, corev1.EventTypeNormal, "PrereqsApplied", "Applied prerequisite bundle %s", c.prereqsBundle.Hash)
+	return managedclusters.SetAnnotations(c.superDomainClientSet, vmc, map[string]string{constants.PrereqsBundleHashAnnotation: c.prereqsBundle.Hash}, opts)
 }
@@ -0,0 +1,531 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/health"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/managedclusters"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/prereqs"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/secretbackend"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	fakeclientset "github.com/verrazzano/verrazzano-crd-generator/pkg/client/clientset/versioned/fake"
+	listers "github.com/verrazzano/verrazzano-crd-generator/pkg/client/listers/verrazzano/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	if err := DefaultOptions().Validate(); err != nil {
+		t.Fatalf("expected default options to be valid, got %v", err)
+	}
+	opts := DefaultOptions()
+	opts.PollInterval = 0
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected zero poll interval to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.PollJitter = -1
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected negative poll jitter to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.SyncRetryInterval = 0
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected zero sync retry interval to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.MetricsPort = 70000
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected out of range metrics port to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.ClusterSources = []string{ClusterSourceRancher, "unknown"}
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected unknown cluster source to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.MirrorNamespaces = []string{"Not_A_Namespace"}
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected invalid mirror namespace to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.EnableWebhook = true
+	opts.Webhook.Port = 0
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected zero webhook port to be rejected")
+	}
+	opts = DefaultOptions()
+	opts.InstallCRD = true
+	opts.CRDEstablishTimeout = 0
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected zero CRD establish timeout to be rejected")
+	}
+}
+
+func TestProcessResyncRequest(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cluster1",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.ResyncRequestedAnnotation: "true", "other": "value"},
+		},
+	}
+	clientSet := fakeclientset.NewSimpleClientset(vmc)
+	c := &Controller{superDomainClientSet: clientSet, resyncCh: make(chan struct{}, 1)}
+
+	c.processResyncRequest(vmc)
+	// a second request while one is pending must not block
+	c.processResyncRequest(vmc)
+
+	select {
+	case <-c.resyncCh:
+	case <-time.After(time.Second):
+		t.Fatalf("expected a resync to be requested")
+	}
+
+	updated, err := clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), "cluster1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error getting VerrazzanoManagedCluster: %v", err)
+	}
+	if _, ok := updated.Annotations[constants.ResyncRequestedAnnotation]; ok {
+		t.Fatalf("expected annotation %s to be cleared", constants.ResyncRequestedAnnotation)
+	}
+	if updated.Annotations["other"] != "value" {
+		t.Fatalf("expected unrelated annotations to be preserved, got %v", updated.Annotations)
+	}
+}
+
+func TestProcessResyncRequestDryRun(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cluster1",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.ResyncRequestedAnnotation: "true"},
+		},
+	}
+	clientSet := fakeclientset.NewSimpleClientset(vmc)
+	options := DefaultOptions()
+	options.DryRun = true
+	c := &Controller{superDomainClientSet: clientSet, options: options, resyncCh: make(chan struct{}, 1)}
+
+	c.processResyncRequest(vmc)
+
+	select {
+	case <-c.resyncCh:
+	default:
+		t.Fatalf("expected a resync to be requested")
+	}
+	if len(clientSet.Actions()) != 0 {
+		t.Fatalf("expected no changes in dry-run mode, got %v", clientSet.Actions())
+	}
+}
+
+func TestProcessResyncRequestWithoutAnnotation(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster1", Namespace: constants.DefaultNamespace},
+	}
+	c := &Controller{superDomainClientSet: fakeclientset.NewSimpleClientset(vmc), resyncCh: make(chan struct{}, 1)}
+
+	c.processResyncRequest(vmc)
+
+	select {
+	case <-c.resyncCh:
+		t.Fatalf("expected no resync to be requested")
+	default:
+	}
+}
+
+func TestFinalizeVerrazzanoManagedCluster(t *testing.T) {
+	now := metav1.Now()
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "cluster1",
+			Namespace:         constants.DefaultNamespace,
+			DeletionTimestamp: &now,
+			Finalizers:        []string{constants.ManagedClusterFinalizer},
+		},
+	}
+	clientSet := fakeclientset.NewSimpleClientset(vmc)
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{superDomainClientSet: clientSet, secretLister: testutil.NewSecretLister(t), recorder: recorder, resyncCh: make(chan struct{}, 1)}
+
+	c.processVerrazzanoManagedCluster(vmc)
+
+	updated, err := clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), "cluster1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error getting VerrazzanoManagedCluster: %v", err)
+	}
+	if len(updated.Finalizers) != 0 {
+		t.Fatalf("expected finalizer to be removed, got %v", updated.Finalizers)
+	}
+	select {
+	case event := <-recorder.Events:
+		if event != "Normal Finalized Managed cluster cleanup completed" {
+			t.Fatalf("unexpected event %s", event)
+		}
+	default:
+		t.Fatalf("expected a Finalized event")
+	}
+}
+
+func TestCleanupManagedClusterRevokesToken(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster1", Namespace: constants.DefaultNamespace},
+		Spec:       v1beta1.VerrazzanoManagedClusterSpec{KubeconfigSecret: "verrazzano-managed-cluster-cluster1"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "verrazzano-managed-cluster-cluster1",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.RancherTokenAnnotation: "kubeconfig-user-abcde"},
+		},
+	}
+	c := &Controller{secretLister: testutil.NewSecretLister(t, secret), options: Options{DryRun: true}}
+
+	opts := managedclusters.Options{DryRun: true, Plan: &managedclusters.Plan{}}
+	if err := c.revokeToken(managedclusters.GetSecretTokenName(secret), opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changes := opts.Plan.Changes()
+	if len(changes) != 1 || changes[0].Kind != "RancherToken" || changes[0].Name != "kubeconfig-user-abcde" || changes[0].Action != managedclusters.ActionDelete {
+		t.Fatalf("expected the token to be planned for revocation, got %+v", changes)
+	}
+	if err := c.cleanupManagedCluster(vmc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigureClusterPrereqs(t *testing.T) {
+	bundle, err := prereqs.DefaultBundle(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cluster1",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.PrereqsBundleHashAnnotation: bundle.Hash},
+		},
+	}
+	clientSet := fakeclientset.NewSimpleClientset(vmc)
+	c := &Controller{superDomainClientSet: clientSet, prereqsBundle: bundle, recorder: record.NewFakeRecorder(10)}
+	cluster := source.Cluster{Name: "cluster1"}
+
+	// A bundle with the same hash was applied before, the cluster is not contacted
+	if err = c.configureClusterPrereqs(cluster, vmc, managedclusters.Options{}); err != nil {
+		t.Fatalf("expected an applied bundle to be skipped, got %v", err)
+	}
+
+	// A changed bundle is planned in dry-run mode, without recording its hash
+	vmc.Annotations[constants.PrereqsBundleHashAnnotation] = "old"
+	opts := managedclusters.Options{DryRun: true, Plan: &managedclusters.Plan{}}
+	if err = c.configureClusterPrereqs(cluster, vmc, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changes := opts.Plan.Changes()
+	if len(changes) != 1 || changes[0].Kind != "PrereqsBundle" || changes[0].Name != "cluster1" {
+		t.Fatalf("expected the bundle to be planned, got %v", changes)
+	}
+	if len(clientSet.Actions()) != 0 {
+		t.Fatalf("expected no changes in dry-run mode, got %v", clientSet.Actions())
+	}
+}
+
+func TestToServiceAccountKubeconfigBootstrap(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cluster1",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.ServiceAccountHashAnnotation: "old"},
+		},
+	}
+	cluster := source.Cluster{ID: "c-1", Name: "cluster1", ServerAddress: "10.0.0.2:6443"}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster1-kubeconfig",
+			Namespace: constants.DefaultNamespace,
+			Labels:    map[string]string{constants.ClusterIDLabel: "c-1"},
+		},
+		Data: map[string][]byte{constants.KubeconfigSecretKey: []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: managed-cluster
+  cluster:
+    server: https://10.0.0.1:6443
+users:
+- name: managed-cluster
+  user:
+    token: sa-token
+contexts:
+- name: managed-cluster
+  context:
+    cluster: managed-cluster
+    user: managed-cluster
+current-context: managed-cluster
+`)},
+	}
+	c := &Controller{serviceAccountHash: "current", secretLister: testutil.NewSecretLister(t, secret), secretBackend: secretbackend.Kubernetes{}}
+
+	// Changed service account resources are bootstrapped again, which needs a Rancher kubeconfig
+	if _, err := c.toServiceAccountKubeconfig(cluster, vmc, managedclusters.Options{}); err == nil || !strings.Contains(err.Error(), "service account resources changed") {
+		t.Fatalf("expected the service account to need bootstrapping, got %v", err)
+	}
+
+	// A stored kubeconfig of a previous API server address is not reused
+	vmc.Annotations[constants.ServiceAccountHashAnnotation] = "current"
+	if _, err := c.getBootstrappedKubeconfig(cluster, vmc); err == nil {
+		t.Fatalf("expected a kubeconfig of a previous API server address to be rejected")
+	}
+	if _, err := c.toServiceAccountKubeconfig(cluster, vmc, managedclusters.Options{}); err == nil || !strings.Contains(err.Error(), "no kubeconfig to bootstrap") {
+		t.Fatalf("expected the service account to need bootstrapping, got %v", err)
+	}
+
+	// The server address override of the VerrazzanoManagedCluster takes precedence over the address of the source
+	vmc.Annotations[constants.ServerAddressOverrideAnnotation] = "10.0.0.3:6443"
+	if _, err := c.getBootstrappedKubeconfig(cluster, vmc); err == nil || !strings.Contains(err.Error(), "10.0.0.3:6443") {
+		t.Fatalf("expected the kubeconfig to be checked against the overridden address, got %v", err)
+	}
+}
+
+func TestSkipKubeconfig(t *testing.T) {
+	now := time.Now()
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster1",
+			Namespace: constants.DefaultNamespace,
+			Labels:    map[string]string{constants.ClusterIDLabel: "c-1"},
+		},
+		Spec: v1beta1.VerrazzanoManagedClusterSpec{KubeconfigSecret: "cluster1-kubeconfig"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cluster1-kubeconfig",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.KubeconfigRotatedAtAnnotation: now.Add(-30 * time.Minute).UTC().Format(time.RFC3339)},
+		},
+		Data: map[string][]byte{constants.KubeconfigSecretKey: []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster1
+  cluster:
+    server: https://rancher.example.com/k8s/clusters/c-1
+users:
+- name: cluster1
+  user:
+    token: kubeconfig-user-1:secret
+contexts:
+- name: cluster1
+  context:
+    cluster: cluster1
+    user: cluster1
+current-context: cluster1
+`)},
+	}
+	options := DefaultOptions()
+	options.KubeconfigRotation = managedclusters.RotationPolicy{MaxAge: time.Hour}
+	c := &Controller{
+		options:                        options,
+		retries:                        newSyncRetries(options.SyncRetryInterval, options.PollInterval),
+		secretBackend:                  secretbackend.Kubernetes{},
+		secretLister:                   testutil.NewSecretLister(t, secret),
+		verrazzanoManagedClusterLister: testutil.NewVerrazzanoManagedClusterLister(t, vmc),
+	}
+
+	if !c.skipKubeconfig(source.Cluster{ID: "c-1", Name: "cluster1"}) {
+		t.Errorf("expected a stored kubeconfig that isn't due for rotation to be current")
+	}
+	if c.skipKubeconfig(source.Cluster{ID: "c-2", Name: "cluster2"}) {
+		t.Errorf("expected a cluster without a VerrazzanoManagedCluster to need a kubeconfig")
+	}
+	c.options.KubeconfigRotation.MaxAge = 10 * time.Minute
+	if c.skipKubeconfig(source.Cluster{ID: "c-1", Name: "cluster1"}) {
+		t.Errorf("expected a stored kubeconfig that is due for rotation to need a new kubeconfig")
+	}
+	c.prereqsBundle = &prereqs.Bundle{Hash: "new"}
+	c.options.KubeconfigRotation.MaxAge = time.Hour
+	if c.skipKubeconfig(source.Cluster{ID: "c-1", Name: "cluster1"}) {
+		t.Errorf("expected a changed prerequisite bundle to need a new kubeconfig")
+	}
+
+	// A paused VerrazzanoManagedCluster is left alone, no kubeconfig is needed
+	paused := vmc.DeepCopy()
+	paused.Annotations = map[string]string{constants.PausedAnnotation: "true"}
+	c.verrazzanoManagedClusterLister = testutil.NewVerrazzanoManagedClusterLister(t, paused)
+	if !c.skipKubeconfig(source.Cluster{ID: "c-1", Name: "cluster1"}) {
+		t.Errorf("expected a paused VerrazzanoManagedCluster to need no kubeconfig")
+	}
+
+	// A cluster whose sync is deferred needs no kubeconfig until its retry backoff elapses
+	c.retries.failed("c-2", time.Now())
+	if !c.skipKubeconfig(source.Cluster{ID: "c-2", Name: "cluster2"}) {
+		t.Errorf("expected a deferred cluster to need no kubeconfig")
+	}
+}
+
+func TestProbeManagedClusters(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cluster1",
+			Namespace: constants.DefaultNamespace,
+			Labels:    map[string]string{constants.K8SAppLabel: constants.VerrazzanoGroup},
+		},
+		Spec: v1beta1.VerrazzanoManagedClusterSpec{KubeconfigSecret: "cluster1-kubeconfig"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster1-kubeconfig", Namespace: constants.DefaultNamespace},
+		Data:       map[string][]byte{constants.KubeconfigSecretKey: []byte("kubeconfig1")},
+	}
+	// A paused cluster is not probed
+	paused := vmc.DeepCopy()
+	paused.Name = "paused"
+	paused.Annotations = map[string]string{constants.PausedAnnotation: "true"}
+	indexer := testutil.NewIndexer(t, vmc, paused)
+	clientSet := fakeclientset.NewSimpleClientset(vmc, paused)
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{
+		superDomainClientSet:           clientSet,
+		secretLister:                   testutil.NewSecretLister(t, secret),
+		verrazzanoManagedClusterLister: listers.NewVerrazzanoManagedClusterLister(indexer),
+		options:                        DefaultOptions(),
+		recorder:                       recorder,
+	}
+
+	probedAt := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	c.probeManagedClusters(func(target health.Target, timeout time.Duration) health.Result {
+		if target.Name != "cluster1" || target.KubeconfigContents != "kubeconfig1" {
+			t.Fatalf("expected only the stored kubeconfig of cluster1 to be probed, got %s", target.Name)
+		}
+		return health.Result{Reason: "connection refused", ProbedAt: probedAt, Latency: 1500 * time.Millisecond}
+	})
+
+	updated, err := clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), "cluster1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Annotations[constants.HealthStatusAnnotation] != health.StatusUnhealthy || updated.Annotations[constants.ProbeFailureReasonAnnotation] != "connection refused" {
+		t.Fatalf("expected the probe result to be recorded, got %v", updated.Annotations)
+	}
+	if updated.Annotations[constants.ProbeLatencyAnnotation] != "1.5s" || updated.Annotations[constants.LastProbeTimeAnnotation] != "2020-11-01T12:00:00Z" {
+		t.Fatalf("expected the probe latency and time to be recorded, got %v", updated.Annotations)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "ClusterUnhealthy") {
+			t.Fatalf("expected a ClusterUnhealthy event, got %s", event)
+		}
+	default:
+		t.Fatalf("expected an event for the health change")
+	}
+	if probeLatency.Get("cluster1") == nil || lastProbeTime.Get("cluster1") == nil {
+		t.Fatalf("expected the probe latency and time to be published")
+	}
+
+	// An unchanged health status is recorded with the new probe time, without another event
+	indexer.Update(updated)
+	c.probeManagedClusters(func(target health.Target, timeout time.Duration) health.Result {
+		return health.Result{Reason: "connection refused", ProbedAt: probedAt.Add(time.Minute), Latency: time.Second}
+	})
+	updated, err = clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), "cluster1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.Annotations[constants.ProbeLatencyAnnotation] != "1s" || updated.Annotations[constants.LastProbeTimeAnnotation] != "2020-11-01T12:01:00Z" {
+		t.Fatalf("expected the new probe latency and time to be recorded, got %v", updated.Annotations)
+	}
+	select {
+	case event := <-recorder.Events:
+		t.Fatalf("expected no event for an unchanged health status, got %s", event)
+	default:
+	}
+}
+
+func TestProcessRegistrationRequestDryRun(t *testing.T) {
+	vmc := &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "lab1",
+			Namespace:   constants.DefaultNamespace,
+			Annotations: map[string]string{constants.RegisterInRancherAnnotation: "true"},
+		},
+		Spec: v1beta1.VerrazzanoManagedClusterSpec{KubeconfigSecret: "lab1-kubeconfig"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "lab1-kubeconfig", Namespace: constants.DefaultNamespace},
+		Data:       map[string][]byte{constants.KubeconfigSecretKey: []byte("kubeconfig")},
+	}
+	clientSet := fakeclientset.NewSimpleClientset(vmc)
+	options := DefaultOptions()
+	options.DryRun = true
+	c := &Controller{superDomainClientSet: clientSet, secretLister: testutil.NewSecretLister(t, secret), options: options, recorder: record.NewFakeRecorder(10)}
+
+	opts := c.managedClusterOptions()
+	if _, err := c.registerInRancher(vmc, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	changes := opts.Plan.Changes()
+	if len(changes) != 1 || changes[0].Kind != "RancherCluster" || changes[0].Name != "lab1" {
+		t.Fatalf("expected the Rancher import to be planned, got %v", changes)
+	}
+
+	// Without its kubeconfig secret the cluster can't be registered
+	c.secretLister = testutil.NewSecretLister(t)
+	if _, err := c.registerInRancher(vmc, c.managedClusterOptions()); err == nil {
+		t.Fatalf("expected an error for a missing kubeconfig secret")
+	}
+
+	// The request is queued, and a failed registration is requeued with backoff
+	c.verrazzanoManagedClusterLister = testutil.NewVerrazzanoManagedClusterLister(t, vmc)
+	c.registrationQueue = workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer c.registrationQueue.ShutDown()
+	c.processRegistrationRequest(vmc)
+	if c.registrationQueue.Len() != 1 {
+		t.Fatalf("expected the registration to be queued, got %d", c.registrationQueue.Len())
+	}
+	if !c.processNextRegistration() || c.registrationQueue.NumRequeues("default/lab1") != 1 {
+		t.Fatalf("expected the failed registration to be requeued")
+	}
+	if len(clientSet.Actions()) != 0 {
+		t.Fatalf("expected no changes to the VerrazzanoManagedCluster, got %v", clientSet.Actions())
+	}
+}
+
+func TestReportOverrides(t *testing.T) {
+	old := &v1beta1.VerrazzanoManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster1", Namespace: constants.DefaultNamespace}}
+	vmc := old.DeepCopy()
+	vmc.Annotations = map[string]string{constants.PausedAnnotation: "true", constants.ServerAddressOverrideAnnotation: "lb.example.com:6443"}
+	recorder := record.NewFakeRecorder(10)
+	c := &Controller{recorder: recorder}
+
+	if !c.reportOverrides(old, vmc) {
+		t.Fatalf("expected the override annotations to be reported as changed")
+	}
+	if len(recorder.Events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "Paused") {
+		t.Fatalf("expected a Paused event, got %s", event)
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "ServerAddressOverridden") || !strings.Contains(event, "lb.example.com:6443") {
+		t.Fatalf("expected a ServerAddressOverridden event, got %s", event)
+	}
+
+	if c.reportOverrides(vmc, vmc.DeepCopy()) || len(recorder.Events) != 0 {
+		t.Fatalf("expected no events for unchanged annotations")
+	}
+	if !c.reportOverrides(vmc, old) {
+		t.Fatalf("expected the removal of the override annotations to be reported")
+	}
+	if event := <-recorder.Events; !strings.Contains(event, "Resumed") {
+		t.Fatalf("expected a Resumed event, got %s", event)
+	}
+}
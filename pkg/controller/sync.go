@@ -0,0 +1,187 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Tracks the outcome of syncing each managed cluster, so that a failing cluster is retried on its own without holding
+// up the others
+
+package controller
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Sync metrics published by expvar, served at /debug/vars of the metrics port
+var (
+	syncedClusters   = expvar.NewInt("cluster_sync_succeeded_total")
+	failedClusters   = expvar.NewInt("cluster_sync_failed_total")
+	deferredClusters = expvar.NewInt("cluster_sync_deferred_total")
+	failedPolls      = expvar.NewInt("cluster_sync_source_failures_total")
+	lastSyncSummary  = &publishedSummary{}
+)
+
+func init() {
+	expvar.Publish("cluster_sync_last_poll", expvar.Func(lastSyncSummary.get))
+}
+
+// syncRetries tracks the clusters that failed to sync by ID.  Each failed cluster is retried after its own backoff,
+// which starts at the initial interval and doubles with every consecutive failure up to the maximum.
+type syncRetries struct {
+	initial  time.Duration
+	max      time.Duration
+	clusters map[string]*retryState
+}
+
+type retryState struct {
+	failures int
+	next     time.Time
+}
+
+func newSyncRetries(initial time.Duration, max time.Duration) *syncRetries {
+	return &syncRetries{initial: initial, max: max, clusters: map[string]*retryState{}}
+}
+
+// due returns true if the cluster has no pending backoff
+func (r *syncRetries) due(id string, now time.Time) bool {
+	state, ok := r.clusters[id]
+	return !ok || !now.Before(state.next)
+}
+
+// failed records a failure of the cluster, returns the backoff before it is retried
+func (r *syncRetries) failed(id string, now time.Time) time.Duration {
+	state, ok := r.clusters[id]
+	if !ok {
+		state = &retryState{}
+		r.clusters[id] = state
+	}
+	backoff := r.initial
+	for i := 0; i < state.failures && backoff < r.max; i++ {
+		backoff *= 2
+	}
+	if backoff > r.max {
+		backoff = r.max
+	}
+	state.failures++
+	state.next = now.Add(backoff)
+	return backoff
+}
+
+// succeeded clears the backoff of the cluster
+func (r *syncRetries) succeeded(id string) {
+	delete(r.clusters, id)
+}
+
+// retain forgets the clusters that are no longer registered
+func (r *syncRetries) retain(ids map[string]bool) {
+	for id := range r.clusters {
+		if !ids[id] {
+			delete(r.clusters, id)
+		}
+	}
+}
+
+// nextRetry returns the earliest time a failed cluster is due, if any
+func (r *syncRetries) nextRetry() (time.Time, bool) {
+	var next time.Time
+	for _, state := range r.clusters {
+		if next.IsZero() || state.next.Before(next) {
+			next = state.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// syncSummary is the outcome of syncing the clusters of a single poll
+type syncSummary struct {
+	Source string    `json:"source"`
+	Time   time.Time `json:"time"`
+	// Synced are the names of the clusters synced successfully
+	Synced []string `json:"synced"`
+	// Failed are the errors of the clusters that failed to sync by name
+	Failed map[string]string `json:"failed"`
+	// Deferred are the names of previously failed clusters whose backoff hasn't elapsed yet
+	Deferred []string `json:"deferred"`
+}
+
+func newSyncSummary(sourceName string, now time.Time) *syncSummary {
+	return &syncSummary{Source: sourceName, Time: now, Synced: []string{}, Failed: map[string]string{}, Deferred: []string{}}
+}
+
+func (s *syncSummary) succeeded(name string) {
+	s.Synced = append(s.Synced, name)
+}
+
+func (s *syncSummary) failed(name string, err error) {
+	s.Failed[name] = err.Error()
+}
+
+func (s *syncSummary) deferred(name string) {
+	s.Deferred = append(s.Deferred, name)
+}
+
+// Logs the summary and publishes it to the sync metrics
+func (s *syncSummary) report() {
+	syncedClusters.Add(int64(len(s.Synced)))
+	failedClusters.Add(int64(len(s.Failed)))
+	deferredClusters.Add(int64(len(s.Deferred)))
+	lastSyncSummary.set(s)
+
+	if len(s.Failed) == 0 && len(s.Deferred) == 0 {
+		zap.S().Infof("Synced %d clusters of %s.", len(s.Synced), s.Source)
+		return
+	}
+	var names []string
+	for name := range s.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failures []string
+	for _, name := range names {
+		failures = append(failures, name+": "+s.Failed[name])
+	}
+	zap.S().Warnf("Synced %d clusters of %s, %d failed and %d are waiting to be retried. Failed clusters: [%s], waiting clusters: [%s]",
+		len(s.Synced), s.Source, len(s.Failed), len(s.Deferred), strings.Join(failures, "; "), strings.Join(s.Deferred, ", "))
+}
+
+// publishedSummary holds the summary of the last poll, read concurrently by the metrics endpoint
+type publishedSummary struct {
+	mutex   sync.Mutex
+	summary *syncSummary
+}
+
+func (p *publishedSummary) set(summary *syncSummary) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.summary = summary
+}
+
+func (p *publishedSummary) get() interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.summary
+}
+
+// Serves the sync and probe metrics until the stop channel is closed
+func startMetricsServer(port int, stopCh <-chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	server := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+	go func() {
+		zap.S().Infof("Serving the cluster metrics on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.S().Errorf("Failed to serve the cluster metrics, for the reason (%v)", err)
+		}
+	}()
+	go func() {
+		<-stopCh
+		server.Shutdown(context.Background())
+	}()
+}
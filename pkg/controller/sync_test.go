@@ -0,0 +1,220 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/naming"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/prereqs"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/rancher"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	fakeclientset "github.com/verrazzano/verrazzano-crd-generator/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// cluster source returning a fixed inventory
+type staticSource []source.Cluster
+
+func (s staticSource) Name() string {
+	return "static"
+}
+
+func (s staticSource) GetClusters() ([]source.Cluster, error) {
+	return s, nil
+}
+
+func TestSyncRetries(t *testing.T) {
+	now := time.Now()
+	retries := newSyncRetries(time.Second, 5*time.Second)
+	if !retries.due("c1", now) {
+		t.Fatalf("expected a cluster without failures to be due")
+	}
+	if _, ok := retries.nextRetry(); ok {
+		t.Fatalf("expected no retry without failures")
+	}
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if backoff := retries.failed("c1", now); backoff != expected {
+			t.Fatalf("expected a backoff of %v, got %v", expected, backoff)
+		}
+	}
+	if retries.due("c1", now.Add(4*time.Second)) || !retries.due("c1", now.Add(5*time.Second)) {
+		t.Fatalf("expected the cluster to be due once its backoff elapses")
+	}
+	if next, ok := retries.nextRetry(); !ok || !next.Equal(now.Add(5*time.Second)) {
+		t.Fatalf("expected the next retry at %v, got %v", now.Add(5*time.Second), next)
+	}
+
+	// A success resets the backoff
+	retries.succeeded("c1")
+	if !retries.due("c1", now) || retries.failed("c1", now) != time.Second {
+		t.Fatalf("expected the backoff to be reset")
+	}
+
+	// Deregistered clusters are forgotten
+	retries.retain(map[string]bool{"c2": true})
+	if _, ok := retries.nextRetry(); ok {
+		t.Fatalf("expected the deregistered cluster to be forgotten")
+	}
+}
+
+func TestSyncClustersIsolatesFailures(t *testing.T) {
+	healthy := source.Cluster{ID: "c-healthy", Name: "healthy", KubeConfigContents: "kubeconfig", ServerAddress: "10.0.0.1:6443"}
+	broken := source.Cluster{ID: "c-broken", Name: "broken", Err: errors.New("failed to generate the kubeconfig")}
+	existing := &v1beta1.VerrazzanoManagedCluster{ObjectMeta: metav1.ObjectMeta{
+		Name:      "broken",
+		Namespace: constants.DefaultNamespace,
+		Labels: map[string]string{
+			constants.K8SAppLabel:            constants.VerrazzanoGroup,
+			constants.VerrazzanoClusterLabel: "broken",
+			constants.ClusterIDLabel:         util.GetClusterIDLabelValue(broken.ID),
+		},
+	}}
+	// Fake clients don't support apply patches, answer them with the patched resource
+	kubeClientSet := fake.NewSimpleClientset()
+	kubeClientSet.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: action.(k8stesting.PatchAction).GetName()}}, nil
+	})
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+	clientSet.PrependReactor("patch", "verrazzanomanagedclusters", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &v1beta1.VerrazzanoManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: action.(k8stesting.PatchAction).GetName()}}, nil
+	})
+	options := DefaultOptions()
+	options.ConfigurePrereqs = false
+	c := &Controller{
+		kubeClientSet:                  kubeClientSet,
+		superDomainClientSet:           clientSet,
+		secretLister:                   testutil.NewSecretLister(t),
+		verrazzanoManagedClusterLister: testutil.NewVerrazzanoManagedClusterLister(t, existing),
+		clusterSource:                  staticSource{broken, healthy},
+		namingRules:                    naming.DefaultRules(),
+		options:                        options,
+		recorder:                       record.NewFakeRecorder(10),
+		retries:                        newSyncRetries(options.SyncRetryInterval, options.PollInterval),
+	}
+
+	now := time.Now()
+	summary := c.syncClusters(staticSource{broken, healthy}, now, true)
+	if len(summary.Synced) != 1 || summary.Synced[0] != "healthy" {
+		t.Fatalf("expected the healthy cluster to be synced, got %v", summary.Synced)
+	}
+	if summary.Failed["broken"] != "failed to generate the kubeconfig" {
+		t.Fatalf("expected the broken cluster to fail, got %v", summary.Failed)
+	}
+	if delay := c.nextPollDelay(now); delay > options.SyncRetryInterval {
+		t.Fatalf("expected the next poll to be brought forward to the retry, got %v", delay)
+	}
+
+	// The broken cluster is deferred until its backoff elapses, and never pruned
+	summary = c.syncClusters(staticSource{broken, healthy}, now.Add(time.Second), true)
+	if len(summary.Deferred) != 1 || summary.Deferred[0] != "broken" || len(summary.Failed) != 0 {
+		t.Fatalf("expected the broken cluster to be deferred, got %+v", summary)
+	}
+	for _, action := range clientSet.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Fatalf("expected the broken cluster not to be pruned, got %v", action)
+		}
+	}
+
+	// Clusters missing from an incomplete inventory are not pruned either
+	c.syncClusters(staticSource{healthy}, now.Add(2*time.Second), false)
+	for _, action := range clientSet.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Fatalf("expected the missing cluster not to be pruned, got %v", action)
+		}
+	}
+
+	// Once it recovers it is synced again
+	summary = c.syncClusters(staticSource{healthy, {ID: "c-broken", Name: "broken", KubeConfigContents: "kubeconfig"}}, now.Add(options.SyncRetryInterval), true)
+	if len(summary.Synced) != 2 || len(summary.Failed) != 0 || len(summary.Deferred) != 0 {
+		t.Fatalf("expected both clusters to be synced, got %+v", summary)
+	}
+	if _, ok := c.retries.nextRetry(); ok {
+		t.Fatalf("expected no pending retries")
+	}
+}
+
+func TestSyncClustersRevokesUnusedTokens(t *testing.T) {
+	var revoked []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodDelete {
+			revoked = append(revoked, strings.TrimPrefix(req.URL.Path, "/v3/tokens/"))
+		}
+	}))
+	defer server.Close()
+	options := DefaultOptions()
+	c := &Controller{
+		rancherConfig:                  rancher.Config{URL: server.URL},
+		kubeClientSet:                  fake.NewSimpleClientset(),
+		superDomainClientSet:           fakeclientset.NewSimpleClientset(),
+		secretLister:                   testutil.NewSecretLister(t),
+		verrazzanoManagedClusterLister: testutil.NewVerrazzanoManagedClusterLister(t),
+		clusterSource:                  staticSource{},
+		namingRules:                    naming.DefaultRules(),
+		options:                        options,
+		recorder:                       record.NewFakeRecorder(10),
+		retries:                        newSyncRetries(options.SyncRetryInterval, options.PollInterval),
+	}
+	now := time.Now()
+	c.retries.failed("c-deferred", now)
+
+	// The kubeconfigs of a deferred and a failed cluster are never stored, their tokens are revoked
+	deferred := source.Cluster{ID: "c-deferred", Name: "deferred", KubeConfigContents: "kubeconfig", TokenName: "token-deferred"}
+	broken := source.Cluster{ID: "c-broken", Name: "broken", TokenName: "token-broken", Err: errors.New("failed to generate the kubeconfig")}
+	c.syncClusters(staticSource{deferred, broken}, now.Add(time.Second), false)
+
+	sort.Strings(revoked)
+	if !reflect.DeepEqual(revoked, []string{"token-broken", "token-deferred"}) {
+		t.Fatalf("expected the unused tokens to be revoked, got %v", revoked)
+	}
+}
+
+func TestSyncClustersRetriesPrereqsFailures(t *testing.T) {
+	cluster := source.Cluster{ID: "c-1", Name: "cluster1", KubeConfigContents: "not a kubeconfig", ServerAddress: "10.0.0.1:6443"}
+	bundle, err := prereqs.DefaultBundle(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clientSet := fakeclientset.NewSimpleClientset()
+	clientSet.PrependReactor("patch", "verrazzanomanagedclusters", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &v1beta1.VerrazzanoManagedCluster{ObjectMeta: metav1.ObjectMeta{Name: action.(k8stesting.PatchAction).GetName()}}, nil
+	})
+	options := DefaultOptions()
+	c := &Controller{
+		kubeClientSet:                  fake.NewSimpleClientset(),
+		superDomainClientSet:           clientSet,
+		secretLister:                   testutil.NewSecretLister(t),
+		verrazzanoManagedClusterLister: testutil.NewVerrazzanoManagedClusterLister(t),
+		clusterSource:                  staticSource{cluster},
+		prereqsBundle:                  bundle,
+		namingRules:                    naming.DefaultRules(),
+		options:                        options,
+		recorder:                       record.NewFakeRecorder(10),
+		retries:                        newSyncRetries(options.SyncRetryInterval, options.PollInterval),
+	}
+
+	summary := c.syncClusters(staticSource{cluster}, time.Now(), true)
+	if _, ok := summary.Failed["cluster1"]; !ok || len(summary.Synced) != 0 {
+		t.Fatalf("expected the cluster whose prerequisites failed to fail, got %+v", summary)
+	}
+	if _, ok := c.retries.nextRetry(); !ok {
+		t.Fatalf("expected the cluster to be retried")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles probing the connectivity and version of managed clusters through their stored kubeconfigs
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Health states of a managed cluster
+const (
+	StatusHealthy   = "Healthy"
+	StatusUnhealthy = "Unhealthy"
+)
+
+// Target is a managed cluster to probe
+type Target struct {
+	// Name identifies the cluster in the results
+	Name string
+	// KubeconfigContents is the stored kubeconfig used to access the cluster
+	KubeconfigContents string
+}
+
+// Result is the outcome of probing a managed cluster
+type Result struct {
+	// Healthy is true if the cluster reported its version and is ready
+	Healthy bool
+	// Version is the Kubernetes version of the cluster, if it could be retrieved
+	Version string
+	// Latency is the duration of the probe
+	Latency time.Duration
+	// Reason describes why the probe failed
+	Reason string
+	// ProbedAt is when the probe started
+	ProbedAt time.Time
+}
+
+// Status returns the health state of the result
+func (r Result) Status() string {
+	if r.Healthy {
+		return StatusHealthy
+	}
+	return StatusUnhealthy
+}
+
+// Annotations returns the annotations recording the result on a VerrazzanoManagedCluster.  The last known Kubernetes
+// version is left in place if the version could not be retrieved.
+func (r Result) Annotations() map[string]string {
+	annotations := map[string]string{
+		constants.HealthStatusAnnotation:       r.Status(),
+		constants.ProbeLatencyAnnotation:       r.Latency.Round(time.Millisecond).String(),
+		constants.ProbeFailureReasonAnnotation: r.Reason,
+		constants.LastProbeTimeAnnotation:      r.ProbedAt.UTC().Format(time.RFC3339),
+	}
+	if r.Version != "" {
+		annotations[constants.KubernetesVersionAnnotation] = r.Version
+	}
+	return annotations
+}
+
+// ProbeFunc probes a single managed cluster
+type ProbeFunc func(target Target, timeout time.Duration) Result
+
+// Probe calls /version and /readyz on the managed cluster accessed through the target's kubeconfig
+func Probe(target Target, timeout time.Duration) (result Result) {
+	result.ProbedAt = time.Now()
+	defer func() { result.Latency = time.Since(result.ProbedAt) }()
+
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(target.KubeconfigContents))
+	if err != nil {
+		result.Reason = fmt.Sprintf("invalid kubeconfig: %v", err)
+		return result
+	}
+	cfg.Timeout = timeout
+	clientSet, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		result.Reason = fmt.Sprintf("invalid kubeconfig: %v", err)
+		return result
+	}
+
+	version, err := clientSet.Discovery().ServerVersion()
+	if err != nil {
+		result.Reason = fmt.Sprintf("version check failed: %v", err)
+		return result
+	}
+	result.Version = version.GitVersion
+
+	body, err := clientSet.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(context.TODO())
+	if err != nil {
+		result.Reason = fmt.Sprintf("readiness check failed: %v", err)
+		if len(body) > 0 {
+			result.Reason = fmt.Sprintf("readiness check failed: %s", body)
+		}
+		return result
+	}
+	result.Healthy = true
+	return result
+}
+
+// ProbeAll probes the targets with at most concurrency probes in flight, and returns the results by target name
+func ProbeAll(targets []Target, concurrency int, timeout time.Duration, probe ProbeFunc) map[string]Result {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make(map[string]Result, len(targets))
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, target := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(target Target) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			result := probe(target, timeout)
+			mutex.Lock()
+			results[target.Name] = result
+			mutex.Unlock()
+		}(target)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+)
+
+// Returns a kubeconfig accessing the given server
+func newKubeconfig(server string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+users:
+- name: test
+  user:
+    token: test-token
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+`, server)
+}
+
+// Returns a managed cluster API server that reports the given readiness
+func newAPIServer(ready bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/version":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"major": "1", "minor": "18", "gitVersion": "v1.18.2"}`)
+		case "/readyz":
+			if !ready {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "[-]etcd failed")
+				return
+			}
+			fmt.Fprint(w, "ok")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestProbeHealthy(t *testing.T) {
+	server := newAPIServer(true)
+	defer server.Close()
+
+	result := Probe(Target{Name: "cluster1", KubeconfigContents: newKubeconfig(server.URL)}, time.Second)
+	if !result.Healthy || result.Reason != "" {
+		t.Fatalf("expected the cluster to be healthy, got reason %s", result.Reason)
+	}
+	if result.Version != "v1.18.2" {
+		t.Fatalf("expected version v1.18.2, got %s", result.Version)
+	}
+	if result.Latency <= 0 || result.ProbedAt.IsZero() {
+		t.Fatalf("expected the latency and probe time to be recorded, got %v and %v", result.Latency, result.ProbedAt)
+	}
+}
+
+func TestProbeNotReady(t *testing.T) {
+	server := newAPIServer(false)
+	defer server.Close()
+
+	result := Probe(Target{Name: "cluster1", KubeconfigContents: newKubeconfig(server.URL)}, time.Second)
+	if result.Healthy {
+		t.Fatalf("expected the cluster to be unhealthy")
+	}
+	if result.Version != "v1.18.2" || !strings.Contains(result.Reason, "etcd failed") {
+		t.Fatalf("expected the version and readiness failure to be reported, got %s and %s", result.Version, result.Reason)
+	}
+	annotations := result.Annotations()
+	if annotations[constants.HealthStatusAnnotation] != StatusUnhealthy || annotations[constants.ProbeFailureReasonAnnotation] != result.Reason {
+		t.Fatalf("unexpected annotations %v", annotations)
+	}
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	server := newAPIServer(true)
+	server.Close()
+
+	result := Probe(Target{Name: "cluster1", KubeconfigContents: newKubeconfig(server.URL)}, time.Second)
+	if result.Healthy || !strings.HasPrefix(result.Reason, "version check failed") {
+		t.Fatalf("expected the version check to fail, got %s", result.Reason)
+	}
+	if _, ok := result.Annotations()[constants.KubernetesVersionAnnotation]; ok {
+		t.Fatalf("expected the last known version to be left in place")
+	}
+
+	result = Probe(Target{Name: "cluster1", KubeconfigContents: "not a kubeconfig"}, time.Second)
+	if result.Healthy || !strings.HasPrefix(result.Reason, "invalid kubeconfig") {
+		t.Fatalf("expected an invalid kubeconfig to be reported, got %s", result.Reason)
+	}
+}
+
+func TestProbeAllLimitsConcurrency(t *testing.T) {
+	var targets []Target
+	for i := 0; i < 20; i++ {
+		targets = append(targets, Target{Name: fmt.Sprintf("cluster%d", i)})
+	}
+
+	var mutex sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	probe := func(target Target, timeout time.Duration) Result {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+		return Result{Healthy: true, Version: target.Name}
+	}
+
+	results := ProbeAll(targets, 3, time.Second, probe)
+	if len(results) != len(targets) {
+		t.Fatalf("expected %d results, got %d", len(targets), len(results))
+	}
+	if results["cluster7"].Version != "cluster7" {
+		t.Fatalf("expected results by target name, got %v", results["cluster7"])
+	}
+	if maxInFlight > 3 {
+		t.Fatalf("expected at most 3 probes in flight, got %d", maxInFlight)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles discovery of managed clusters from static kubeconfigs, for environments without Rancher
+
+package kubeconfigs
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// DefaultClusterType is the type of clusters whose kubeconfig is not annotated with a type
+const DefaultClusterType = "kubeconfig"
+
+// DirSource is the cluster source of the kubeconfig files in a directory, such as a mounted ConfigMap or Secret
+type DirSource struct {
+	dir string
+}
+
+// NewDirSource returns a cluster source reading the kubeconfig files in the given directory on every call
+func NewDirSource(dir string) *DirSource {
+	return &DirSource{dir: dir}
+}
+
+// Name identifies the source
+func (s *DirSource) Name() string {
+	return "directory"
+}
+
+// GetClusters returns a cluster for each kubeconfig file in the directory.  Hidden files are skipped, which includes
+// the bookkeeping entries of mounted volumes.  A file that can't be read is returned as a cluster with Err set, so that
+// it doesn't fail the other files.
+func (s *DirSource) GetClusters() ([]source.Cluster, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var clusters []source.Cluster
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		id := "file:" + entry.Name()
+		path := filepath.Join(s.dir, entry.Name())
+		// Files of mounted volumes are symlinks, follow them
+		info, err := os.Stat(path)
+		if err != nil {
+			clusters = append(clusters, newFailedCluster(id, entry.Name(), nil, err))
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err == nil {
+			var cluster source.Cluster
+			if cluster, err = NewCluster(id, contents, nil); err == nil {
+				clusters = append(clusters, cluster)
+				continue
+			}
+		}
+		clusters = append(clusters, newFailedCluster(id, entry.Name(), nil, fmt.Errorf("error reading kubeconfig file %s: %v", entry.Name(), err)))
+	}
+	return clusters, nil
+}
+
+// SecretSource is the cluster source of the Secrets in the admin cluster labelled as managed cluster kubeconfigs
+type SecretSource struct {
+	secretLister corev1listers.SecretLister
+}
+
+// NewSecretSource returns a cluster source listing labelled kubeconfig Secrets from the given lister
+func NewSecretSource(secretLister corev1listers.SecretLister) *SecretSource {
+	return &SecretSource{secretLister: secretLister}
+}
+
+// Name identifies the source
+func (s *SecretSource) Name() string {
+	return "secrets"
+}
+
+// GetClusters returns a cluster for each Secret labelled with KubeconfigSourceLabel.  A Secret without a valid
+// kubeconfig is returned as a cluster with Err set, so that it doesn't fail the other Secrets.
+func (s *SecretSource) GetClusters() ([]source.Cluster, error) {
+	selector := labels.SelectorFromSet(labels.Set{constants.KubeconfigSourceLabel: "true"})
+	secrets, err := s.secretLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	// Listers return objects in no particular order
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Namespace+"/"+secrets[i].Name < secrets[j].Namespace+"/"+secrets[j].Name
+	})
+
+	var clusters []source.Cluster
+	for _, secret := range secrets {
+		contents, ok := secret.Data[constants.KubeconfigSecretKey]
+		if !ok {
+			err = fmt.Errorf("kubeconfig Secret %s/%s has no %s key", secret.Namespace, secret.Name, constants.KubeconfigSecretKey)
+			clusters = append(clusters, newFailedCluster(string(secret.UID), secret.Name, secret.Annotations, err))
+			continue
+		}
+		cluster, err := NewCluster(string(secret.UID), contents, secret.Annotations)
+		if err != nil {
+			err = fmt.Errorf("error reading kubeconfig Secret %s/%s: %v", secret.Namespace, secret.Name, err)
+			cluster = newFailedCluster(string(secret.UID), secret.Name, secret.Annotations, err)
+		}
+		cluster.Labels = secret.Labels
+		cluster.Annotations = secret.Annotations
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// NewCluster derives a cluster from a kubeconfig.  The name of the current context is used as the cluster name and
+// the server of its cluster as the server address, unless overridden by the ClusterNameAnnotation and
+// ClusterTypeAnnotation annotations.
+func NewCluster(id string, contents []byte, annotations map[string]string) (source.Cluster, error) {
+	kubeconfig, err := clientcmd.Load(contents)
+	if err != nil {
+		return source.Cluster{}, err
+	}
+	context, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return source.Cluster{}, errors.New("kubeconfig has no current context")
+	}
+	cluster, ok := kubeconfig.Clusters[context.Cluster]
+	if !ok {
+		return source.Cluster{}, fmt.Errorf("kubeconfig has no cluster %s", context.Cluster)
+	}
+	serverAddress, err := getServerAddress(cluster.Server)
+	if err != nil {
+		return source.Cluster{}, err
+	}
+
+	name := kubeconfig.CurrentContext
+	if annotations[constants.ClusterNameAnnotation] != "" {
+		name = annotations[constants.ClusterNameAnnotation]
+	}
+	clusterType := DefaultClusterType
+	if annotations[constants.ClusterTypeAnnotation] != "" {
+		clusterType = annotations[constants.ClusterTypeAnnotation]
+	}
+	return source.Cluster{
+		ID:                 id,
+		Name:               name,
+		KubeConfigContents: string(contents),
+		ServerAddress:      serverAddress,
+		Type:               clusterType,
+	}, nil
+}
+
+// Returns the cluster of a kubeconfig that can't be read, named after its entry in the source unless overridden by
+// the ClusterNameAnnotation annotation.  It is kept registered, but isn't synced while it fails.
+func newFailedCluster(id string, name string, annotations map[string]string, err error) source.Cluster {
+	if annotations[constants.ClusterNameAnnotation] != "" {
+		name = annotations[constants.ClusterNameAnnotation]
+	}
+	return source.Cluster{ID: id, Name: name, Err: err}
+}
+
+// Split returns the server, certificate authority and credentials of the current context of a kubeconfig, keyed by the
+// VerrazzanoManagedCluster secret keys.  Keys of values the kubeconfig doesn't hold, or only references as files, are
+// omitted.
+func Split(contents []byte) (map[string][]byte, error) {
+	kubeconfig, err := clientcmd.Load(contents)
+	if err != nil {
+		return nil, err
+	}
+	context, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return nil, errors.New("kubeconfig has no current context")
+	}
+	data := map[string][]byte{}
+	if cluster, ok := kubeconfig.Clusters[context.Cluster]; ok {
+		setKey(data, constants.KubeconfigServerKey, []byte(cluster.Server))
+		setKey(data, constants.KubeconfigCAKey, cluster.CertificateAuthorityData)
+	}
+	if authInfo, ok := kubeconfig.AuthInfos[context.AuthInfo]; ok {
+		setKey(data, constants.KubeconfigTokenKey, []byte(authInfo.Token))
+		setKey(data, constants.KubeconfigClientCertKey, authInfo.ClientCertificateData)
+		setKey(data, constants.KubeconfigClientKeyKey, authInfo.ClientKeyData)
+	}
+	return data, nil
+}
+
+// set a key of secret data, unless the value is empty
+func setKey(data map[string][]byte, key string, value []byte) {
+	if len(value) > 0 {
+		data[key] = value
+	}
+}
+
+// get the host:port of an API server URL, defaulting the port by scheme
+func getServerAddress(server string) (string, error) {
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+	if serverURL.Hostname() == "" {
+		return "", fmt.Errorf("invalid server %s", server)
+	}
+	port := serverURL.Port()
+	if port == "" {
+		port = "443"
+		if serverURL.Scheme == "http" {
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(serverURL.Hostname(), port), nil
+}
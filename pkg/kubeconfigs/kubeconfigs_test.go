@@ -0,0 +1,181 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package kubeconfigs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Returns a kubeconfig whose current context accesses the given server
+func newKubeconfig(contextName string, server string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: target
+  cluster:
+    server: %s
+users:
+- name: admin
+  user:
+    token: admin-token
+contexts:
+- name: %s
+  context:
+    cluster: target
+    user: admin
+current-context: %s
+`, server, contextName, contextName)
+}
+
+func TestNewCluster(t *testing.T) {
+	cluster, err := NewCluster("id1", []byte(newKubeconfig("lab1", "https://10.0.0.1:6443")), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cluster.ID != "id1" || cluster.Name != "lab1" || cluster.ServerAddress != "10.0.0.1:6443" || cluster.Type != DefaultClusterType {
+		t.Fatalf("unexpected cluster %v", cluster)
+	}
+
+	// Annotations override the name and type, and the port defaults by scheme
+	annotations := map[string]string{constants.ClusterNameAnnotation: "renamed", constants.ClusterTypeAnnotation: "olcne"}
+	cluster, err = NewCluster("id1", []byte(newKubeconfig("lab1", "https://api.lab1.example.com")), annotations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cluster.Name != "renamed" || cluster.Type != "olcne" || cluster.ServerAddress != "api.lab1.example.com:443" {
+		t.Fatalf("unexpected cluster %v", cluster)
+	}
+
+	if _, err = NewCluster("id1", []byte("current-context: missing"), nil); err == nil {
+		t.Fatalf("expected an error for a kubeconfig without a current context")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	data, err := Split([]byte(newKubeconfig("lab1", "https://10.0.0.1:6443")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 2 || string(data[constants.KubeconfigServerKey]) != "https://10.0.0.1:6443" || string(data[constants.KubeconfigTokenKey]) != "admin-token" {
+		t.Fatalf("unexpected keys %v", data)
+	}
+
+	// Certificate data is split into keys, file references aren't
+	data, err = Split([]byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: target
+  cluster:
+    server: https://10.0.0.1:6443
+    certificate-authority-data: Y2EgY2VydA==
+users:
+- name: admin
+  user:
+    client-certificate-data: Y2xpZW50IGNlcnQ=
+    client-key: /etc/kubernetes/client.key
+contexts:
+- name: lab1
+  context:
+    cluster: target
+    user: admin
+current-context: lab1
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(data) != 3 || string(data[constants.KubeconfigCAKey]) != "ca cert" || string(data[constants.KubeconfigClientCertKey]) != "client cert" {
+		t.Fatalf("unexpected keys %v", data)
+	}
+
+	if _, err = Split([]byte("current-context: missing")); err == nil {
+		t.Fatalf("expected an error for a kubeconfig without a current context")
+	}
+}
+
+func TestDirSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfigs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"lab1":        newKubeconfig("lab1", "https://10.0.0.1:6443"),
+		"lab2.yaml":   newKubeconfig("lab2", "https://10.0.0.2:6443"),
+		"..data-file": "not a kubeconfig",
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Mkdir(filepath.Join(dir, "subdir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	clusters, err := NewDirSource(dir).GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 2 || clusters[0].Name != "lab1" || clusters[1].Name != "lab2" || clusters[1].ID != "file:lab2.yaml" {
+		t.Fatalf("unexpected clusters %v", clusters)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "broken"), []byte("current-context: missing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// An invalid file is returned as a failed cluster, without failing the others
+	clusters, err = NewDirSource(dir).GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 3 || clusters[0].ID != "file:broken" || clusters[0].Err == nil || clusters[1].Err != nil || clusters[2].Err != nil {
+		t.Fatalf("expected the invalid kubeconfig file to fail on its own, got %v", clusters)
+	}
+}
+
+func TestSecretSource(t *testing.T) {
+	labelled := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "lab1",
+			Namespace:   constants.DefaultNamespace,
+			UID:         "uid-1",
+			Labels:      map[string]string{constants.KubeconfigSourceLabel: "true"},
+			Annotations: map[string]string{constants.ClusterTypeAnnotation: "olcne"},
+		},
+		Data: map[string][]byte{constants.KubeconfigSecretKey: []byte(newKubeconfig("lab1", "https://10.0.0.1:6443"))},
+	}
+	unlabelled := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "lab2", Namespace: constants.DefaultNamespace},
+		Data:       map[string][]byte{constants.KubeconfigSecretKey: []byte(newKubeconfig("lab2", "https://10.0.0.2:6443"))},
+	}
+	broken := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "lab3",
+			Namespace:   constants.DefaultNamespace,
+			UID:         "uid-3",
+			Labels:      map[string]string{constants.KubeconfigSourceLabel: "true"},
+			Annotations: map[string]string{constants.ClusterNameAnnotation: "lab3-renamed"},
+		},
+		Data: map[string][]byte{constants.KubeconfigSecretKey: []byte("current-context: missing")},
+	}
+	clusters, err := NewSecretSource(testutil.NewSecretLister(t, labelled, unlabelled, broken)).GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 2 || clusters[0].ID != "uid-1" || clusters[0].Name != "lab1" || clusters[0].Type != "olcne" || clusters[0].Err != nil {
+		t.Fatalf("expected only the labelled secrets, got %v", clusters)
+	}
+	if clusters[1].ID != "uid-3" || clusters[1].Name != "lab3-renamed" || clusters[1].Err == nil {
+		t.Fatalf("expected the invalid kubeconfig secret to fail on its own, got %v", clusters[1])
+	}
+}
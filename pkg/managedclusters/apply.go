@@ -0,0 +1,45 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles server-side apply of resources owned by the operator
+
+package managedclusters
+
+import (
+	"encoding/json"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// applyOptions returns the patch options for a server-side apply by the operator's field manager
+func (o Options) applyOptions() metav1.PatchOptions {
+	force := true
+	return metav1.PatchOptions{FieldManager: constants.FieldManager, Force: &force, DryRun: o.dryRunValues()}
+}
+
+// toApplyPatch converts an object into a server-side apply patch containing only the fields the operator sets.
+// Server populated metadata and status are dropped, as are any of the given optional spec fields that the
+// operator is not to take ownership of.
+func toApplyPatch(obj runtime.Object, gvk schema.GroupVersionKind, unownedSpecFields ...string) ([]byte, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	content["apiVersion"] = gvk.GroupVersion().String()
+	content["kind"] = gvk.Kind
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		for _, field := range []string{"creationTimestamp", "resourceVersion", "uid", "managedFields"} {
+			delete(metadata, field)
+		}
+	}
+	if spec, ok := content["spec"].(map[string]interface{}); ok {
+		for _, field := range unownedSpecFields {
+			delete(spec, field)
+		}
+	}
+	return json.Marshal(content)
+}
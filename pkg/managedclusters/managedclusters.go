@@ -7,9 +7,13 @@ package managedclusters
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
-	"github.com/verrazzano/verrazzano-cluster-operator/pkg/rancher"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/diff"
 	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
@@ -18,72 +22,361 @@ import (
 	"go.uber.org/zap"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
 )
 
-// CreateVerrazzanoManagedCluster creates/updates a VerrazzanoManagedCluster resource
-func CreateVerrazzanoManagedCluster(sdoClientSet sdoClientSet.Interface, tmcLister listers.VerrazzanoManagedClusterLister, cluster rancher.Cluster) error {
+// CreateVerrazzanoManagedCluster creates/updates a VerrazzanoManagedCluster resource using server-side apply, and
+// returns the resulting resource
+func CreateVerrazzanoManagedCluster(sdoClientSet sdoClientSet.Interface, tmcLister listers.VerrazzanoManagedClusterLister, cluster source.Cluster, opts Options) (*v1beta1.VerrazzanoManagedCluster, error) {
 	zap.S().Debugf("Processing VerrazzanoManagedCluster CR '%s' for cluster '%s'", cluster.ID, cluster.Name)
 
-	// Construct the expected VerrazzanoManagedCluster
+	// Construct the expected VerrazzanoManagedCluster, referencing the kubeconfig if stored outside of the secret
 	newTmc := newVerrazzanoManagedCluster(cluster)
+	if location := opts.backend().Location(newTmc.Spec.KubeconfigSecret); location != "" {
+		if newTmc.Annotations == nil {
+			newTmc.Annotations = map[string]string{}
+		}
+		newTmc.Annotations[constants.KubeconfigLocationAnnotation] = location
+	}
 
 	existingTmc, err := tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).Get(newTmc.Name)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
 	if existingTmc != nil {
-		specDiffs := diff.CompareIgnoreTargetEmpties(existingTmc, newTmc)
-		if specDiffs != "" {
-			zap.S().Infof("Updating VerrazzanoManagedCluster CR '%s'", newTmc.Name)
-			zap.S().Debugf("Spec differences:\n%s", specDiffs)
-			newTmc.ResourceVersion = existingTmc.ResourceVersion
-			_, err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Update(context.TODO(), newTmc, metav1.UpdateOptions{})
-		} else {
+		// The name of a cluster may be reused by another cluster after a rename, leave the resource of the other cluster alone
+		if existingID, ok := existingTmc.Labels[constants.ClusterIDLabel]; ok && existingID != newTmc.Labels[constants.ClusterIDLabel] {
+			return nil, fmt.Errorf("VerrazzanoManagedCluster CR '%s' belongs to the cluster with ID label '%s'", newTmc.Name, existingID)
+		}
+		// No new finalizers may be added to a resource being deleted, leave it to be finalized
+		if existingTmc.DeletionTimestamp != nil {
+			zap.S().Infof("VerrazzanoManagedCluster CR '%s' is being deleted, skipping update", newTmc.Name)
+			return existingTmc, nil
+		}
+		if IsPaused(existingTmc) {
+			zap.S().Infof("VerrazzanoManagedCluster CR '%s' is paused, skipping update", newTmc.Name)
+			return existingTmc, nil
+		}
+		if address := GetServerAddressOverride(existingTmc); address != "" {
+			zap.S().Debugf("Overriding server address '%s' of VerrazzanoManagedCluster CR '%s' with '%s'", newTmc.Spec.ServerAddress, newTmc.Name, address)
+			newTmc.Spec.ServerAddress = address
+		}
+		specDiffs := diff.CompareIgnoreTargetEmpties(existingTmc, newTmc) + staleMetadataDiff(existingTmc.ObjectMeta, newTmc.ObjectMeta)
+		if specDiffs == "" {
 			zap.S().Debugf("No need to update existing VerrazzanoManagedCluster CR '%s'", newTmc.Name)
+			return existingTmc, nil
+		}
+		zap.S().Infof("Updating VerrazzanoManagedCluster CR '%s'", newTmc.Name)
+		zap.S().Debugf("Spec differences:\n%s", specDiffs)
+		if opts.DryRun {
+			opts.record(ActionUpdate, "VerrazzanoManagedCluster", newTmc.ObjectMeta, specDiffs)
 		}
 	} else {
 		zap.S().Infof("Creating VerrazzanoManagedCluster CR '%s'", newTmc.Name)
-		_, err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Create(context.TODO(), newTmc, metav1.CreateOptions{})
+		if opts.DryRun {
+			opts.record(ActionCreate, "VerrazzanoManagedCluster", newTmc.ObjectMeta, diff.CompareIgnoreTargetEmpties(&v1beta1.VerrazzanoManagedCluster{}, newTmc))
+		}
 	}
-	if err != nil {
-		return err
+	result := newTmc
+	if !opts.skipAPICall() {
+		// The operator never sets a description, leave it to other managers
+		patch, err := toApplyPatch(newTmc, v1beta1.SchemeGroupVersion.WithKind("VerrazzanoManagedCluster"), "description")
+		if err != nil {
+			return nil, err
+		}
+		result, err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Patch(context.TODO(), newTmc.Name, types.ApplyPatchType, patch, opts.applyOptions())
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	zap.S().Debugf("Successfully processed VerrazzanoManagedCluster CR '%s' for cluster '%s'", cluster.ID, cluster.Name)
-	return nil
+	return result, nil
 }
 
-// DeleteVerrazzanoManagedCluster deletes a VerrazzanoManagedCluster resource
-func DeleteVerrazzanoManagedCluster(sdoClientSet sdoClientSet.Interface, tmcLister listers.VerrazzanoManagedClusterLister, cluster rancher.Cluster) error {
-	zap.S().Debugf("Deleting VerrazzanoManagedCluster CR '%s' for cluster '%s'", cluster.ID, cluster.Name)
+// FindVerrazzanoManagedCluster finds the VerrazzanoManagedCluster of a cluster by the cluster ID label, or by the
+// cluster name for resources created before the ID label was added
+func FindVerrazzanoManagedCluster(tmcLister listers.VerrazzanoManagedClusterLister, cluster source.Cluster) (*v1beta1.VerrazzanoManagedCluster, error) {
+	selector := labels.SelectorFromSet(labels.Set{constants.ClusterIDLabel: util.GetClusterIDLabelValue(cluster.ID)})
+	tmcs, err := tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, tmc := range tmcs {
+		if tmc.Name == cluster.Name || len(tmcs) == 1 {
+			return tmc, nil
+		}
+	}
+	return tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).Get(cluster.Name)
+}
 
-	_, err := tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).Get(cluster.ID)
+// GetRenamedVerrazzanoManagedClusters returns the VerrazzanoManagedClusters of a cluster that are named after a
+// previous name of the cluster
+func GetRenamedVerrazzanoManagedClusters(tmcLister listers.VerrazzanoManagedClusterLister, cluster source.Cluster) ([]*v1beta1.VerrazzanoManagedCluster, error) {
+	selector := labels.SelectorFromSet(labels.Set{constants.ClusterIDLabel: util.GetClusterIDLabelValue(cluster.ID)})
+	tmcs, err := tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).List(selector)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			zap.S().Errorf("VerrazzanoManagedCluster CR `%s` no longer exists for cluster '%s', for the reason (%v)", cluster.ID, cluster.Name, err)
+		return nil, err
+	}
+	var renamed []*v1beta1.VerrazzanoManagedCluster
+	for _, tmc := range tmcs {
+		if tmc.Name != cluster.Name && tmc.DeletionTimestamp == nil {
+			renamed = append(renamed, tmc)
 		}
-		return err
 	}
+	return renamed, nil
+}
 
-	err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Delete(context.TODO(), cluster.ID, metav1.DeleteOptions{})
+// RetireVerrazzanoManagedCluster deletes a VerrazzanoManagedCluster and its secret that were replaced by resources
+// named after the new name of the cluster.  The finalizer is removed first, since the credentials of the secret were
+// migrated to the replacement secret and must not be revoked.
+func RetireVerrazzanoManagedCluster(sdoClientSet sdoClientSet.Interface, kubeClientSet kubernetes.Interface, tmc *v1beta1.VerrazzanoManagedCluster, opts Options) error {
+	if err := RemoveFinalizer(sdoClientSet, tmc, opts); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if opts.DryRun {
+		opts.record(ActionDelete, "VerrazzanoManagedCluster", tmc.ObjectMeta, "")
+		opts.record(ActionDelete, "Secret", metav1.ObjectMeta{Name: tmc.Spec.KubeconfigSecret, Namespace: tmc.Namespace}, "")
+		if opts.skipAPICall() {
+			return nil
+		}
+	}
+	err := sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(tmc.Namespace).Delete(context.TODO(), tmc.Name, metav1.DeleteOptions{DryRun: opts.dryRunValues()})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	secret, err := kubeClientSet.CoreV1().Secrets(tmc.Namespace).Get(context.TODO(), tmc.Spec.KubeconfigSecret, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
 	if err != nil {
-		zap.S().Errorf("Failed to delete VerrazzanoManagedCluster CR '%s' for cluster '%s', for the reason (%v)", cluster.ID, cluster.Name, err)
 		return err
 	}
+	return deleteSecret(kubeClientSet, secret, opts)
+}
+
+// PruneVerrazzanoManagedClusters deletes the VerrazzanoManagedClusters created by the operator for clusters that are no
+// longer in the given list, and returns their names.  Clusters are matched by their ID, or by their name for resources
+// created before the ID label was added.  Cleanup of the deleted clusters is left to the finalizer.
+func PruneVerrazzanoManagedClusters(sdoClientSet sdoClientSet.Interface, tmcLister listers.VerrazzanoManagedClusterLister, clusters []source.Cluster, opts Options) ([]string, error) {
+	current := map[string]bool{}
+	currentIDs := map[string]bool{}
+	for _, cluster := range clusters {
+		current[cluster.Name] = true
+		currentIDs[util.GetClusterIDLabelValue(cluster.ID)] = true
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{constants.K8SAppLabel: constants.VerrazzanoGroup})
+	existingTmcs, err := tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
 
-	zap.S().Debugf("Successfully deleted VerrazzanoManagedCluster CR '%s' for cluster '%s'", cluster.ID, cluster.Name)
-	return nil
+	var pruned []string
+	for _, tmc := range existingTmcs {
+		clusterName, ok := tmc.Labels[constants.VerrazzanoClusterLabel]
+		if !ok || tmc.DeletionTimestamp != nil {
+			continue
+		}
+		if clusterID, ok := tmc.Labels[constants.ClusterIDLabel]; ok && currentIDs[clusterID] {
+			continue
+		} else if !ok && current[clusterName] {
+			continue
+		}
+		if IsPaused(tmc) {
+			zap.S().Infof("VerrazzanoManagedCluster CR '%s' of deregistered cluster '%s' is paused, skipping deletion", tmc.Name, clusterName)
+			continue
+		}
+		zap.S().Infof("Deleting VerrazzanoManagedCluster CR '%s' for deregistered cluster '%s'", tmc.Name, clusterName)
+		if opts.DryRun {
+			opts.record(ActionDelete, "VerrazzanoManagedCluster", tmc.ObjectMeta, "")
+		}
+		if !opts.skipAPICall() {
+			err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Delete(context.TODO(), tmc.Name, metav1.DeleteOptions{DryRun: opts.dryRunValues()})
+			if err != nil && !errors.IsNotFound(err) {
+				return pruned, err
+			}
+		}
+		pruned = append(pruned, tmc.Name)
+	}
+	return pruned, nil
 }
 
 // Constructs a VerrazzanoManagedCluster from the given Cluster
-func newVerrazzanoManagedCluster(cluster rancher.Cluster) *v1beta1.VerrazzanoManagedCluster {
+func newVerrazzanoManagedCluster(cluster source.Cluster) *v1beta1.VerrazzanoManagedCluster {
 	return &v1beta1.VerrazzanoManagedCluster{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      cluster.Name,
-			Namespace: constants.DefaultNamespace,
-			Labels:    util.GetManagedClusterLabels(cluster.Name),
+			Name:        cluster.Name,
+			Namespace:   constants.DefaultNamespace,
+			Labels:      getResourceLabels(cluster),
+			Annotations: getResourceAnnotations(cluster),
+			Finalizers:  []string{constants.ManagedClusterFinalizer},
 		},
 		Spec: v1beta1.VerrazzanoManagedClusterSpec{
-			KubeconfigSecret: util.GetManagedClusterKubeconfigSecretName(cluster.Name),
+			KubeconfigSecret: getSecretName(cluster),
 			ServerAddress:    cluster.ServerAddress,
 			Type:             cluster.Type,
 		},
 	}
 }
+
+// Returns the name of the kubeconfig secret of a cluster, as set by the naming rules
+func getSecretName(cluster source.Cluster) string {
+	if cluster.SecretName != "" {
+		return cluster.SecretName
+	}
+	return util.GetManagedClusterKubeconfigSecretName(cluster.Name)
+}
+
+// Returns the labels of the resources of a cluster, the labels the operator selects resources by take precedence over
+// those of the naming rules
+func getResourceLabels(cluster source.Cluster) map[string]string {
+	labels := map[string]string{}
+	for key, value := range cluster.ResourceLabels {
+		labels[key] = value
+	}
+	for key, value := range util.GetManagedClusterLabels(cluster.Name, cluster.ID) {
+		labels[key] = value
+	}
+	return labels
+}
+
+// Returns the annotations of the resources of a cluster, recording the keys of the labels and annotations set by the
+// naming rules
+func getResourceAnnotations(cluster source.Cluster) map[string]string {
+	if len(cluster.ResourceLabels) == 0 && len(cluster.ResourceAnnotations) == 0 {
+		return nil
+	}
+	annotations := map[string]string{}
+	for key, value := range cluster.ResourceAnnotations {
+		annotations[key] = value
+	}
+	if keys := sortedKeys(cluster.ResourceLabels); keys != "" {
+		annotations[constants.GeneratedLabelsAnnotation] = keys
+	}
+	if keys := sortedKeys(cluster.ResourceAnnotations); keys != "" {
+		annotations[constants.GeneratedAnnotationsAnnotation] = keys
+	}
+	return annotations
+}
+
+// Returns the comma separated keys of a map in order
+func sortedKeys(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Describes the labels and annotations set by the naming rules on an existing resource that are no longer set on the
+// desired resource.  Removals aren't differences to CompareIgnoreTargetEmpties, yet they require the resource to be
+// applied for the server to remove them.
+func staleMetadataDiff(existing metav1.ObjectMeta, desired metav1.ObjectMeta) string {
+	var stale string
+	for _, key := range strings.Split(existing.Annotations[constants.GeneratedLabelsAnnotation], ",") {
+		if _, ok := desired.Labels[key]; key != "" && !ok {
+			stale += fmt.Sprintf("-: label %s\n", key)
+		}
+	}
+	for _, key := range strings.Split(existing.Annotations[constants.GeneratedAnnotationsAnnotation], ",") {
+		if _, ok := desired.Annotations[key]; key != "" && !ok {
+			stale += fmt.Sprintf("-: annotation %s\n", key)
+		}
+	}
+	return stale
+}
+
+// HasFinalizer returns true if the VerrazzanoManagedCluster carries the operator's finalizer
+func HasFinalizer(tmc *v1beta1.VerrazzanoManagedCluster) bool {
+	for _, finalizer := range tmc.Finalizers {
+		if finalizer == constants.ManagedClusterFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveFinalizer removes the operator's finalizer from a VerrazzanoManagedCluster, allowing its deletion to complete
+func RemoveFinalizer(sdoClientSet sdoClientSet.Interface, tmc *v1beta1.VerrazzanoManagedCluster, opts Options) error {
+	if !HasFinalizer(tmc) {
+		return nil
+	}
+	index := -1
+	updated := tmc.DeepCopy()
+	updated.Finalizers = nil
+	for i, finalizer := range tmc.Finalizers {
+		if finalizer == constants.ManagedClusterFinalizer && index < 0 {
+			index = i
+			continue
+		}
+		updated.Finalizers = append(updated.Finalizers, finalizer)
+	}
+	if opts.DryRun {
+		opts.record(ActionUpdate, "VerrazzanoManagedCluster", updated.ObjectMeta, diff.CompareIgnoreTargetEmpties(tmc.Finalizers, updated.Finalizers))
+		if opts.skipAPICall() {
+			return nil
+		}
+	}
+	// Only the finalizer is patched, guarded by a test so that a concurrent change of the finalizers fails the patch
+	// instead of removing the wrong one, while concurrent changes of other fields don't conflict
+	path := fmt.Sprintf("/metadata/finalizers/%d", index)
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": path, "value": constants.ManagedClusterFinalizer},
+		{"op": "remove", "path": path},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(tmc.Namespace).Patch(context.TODO(), tmc.Name, types.JSONPatchType, patch, metav1.PatchOptions{DryRun: opts.dryRunValues()})
+	return err
+}
+
+// NewOwnerReference returns an owner reference to the given VerrazzanoManagedCluster
+func NewOwnerReference(tmc *v1beta1.VerrazzanoManagedCluster) metav1.OwnerReference {
+	isController := true
+	blockOwnerDeletion := true
+	return metav1.OwnerReference{
+		APIVersion:         v1beta1.SchemeGroupVersion.String(),
+		Kind:               "VerrazzanoManagedCluster",
+		Name:               tmc.Name,
+		UID:                tmc.UID,
+		Controller:         &isController,
+		BlockOwnerDeletion: &blockOwnerDeletion,
+	}
+}
+
+// SetAnnotations sets annotations on a VerrazzanoManagedCluster with a merge patch, outside of the configuration the
+// operator applies, so that later applies leave them in place.  Annotations with empty values are removed.
+func SetAnnotations(sdoClientSet sdoClientSet.Interface, tmc *v1beta1.VerrazzanoManagedCluster, annotations map[string]string, opts Options) error {
+	current := map[string]string{}
+	changes := map[string]interface{}{}
+	for key, value := range annotations {
+		if tmc.Annotations[key] == value {
+			continue
+		}
+		current[key] = tmc.Annotations[key]
+		changes[key] = value
+		if value == "" {
+			changes[key] = nil
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	if opts.DryRun {
+		opts.record(ActionUpdate, "VerrazzanoManagedCluster", tmc.ObjectMeta, diff.CompareIgnoreTargetEmpties(current, annotations))
+		if opts.skipAPICall() {
+			return nil
+		}
+	}
+	patch, err := json.Marshal(map[string]interface{}{"metadata": map[string]interface{}{"annotations": changes}})
+	if err != nil {
+		return err
+	}
+	_, err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(tmc.Namespace).Patch(context.TODO(), tmc.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: constants.FieldManager, DryRun: opts.dryRunValues()})
+	return err
+}
@@ -4,14 +4,21 @@
 package managedclusters
 
 import (
+	"context"
 	"testing"
 
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
-	"github.com/verrazzano/verrazzano-cluster-operator/pkg/rancher"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	fakeclientset "github.com/verrazzano/verrazzano-crd-generator/pkg/client/clientset/versioned/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestNewVerrazzanoManagedCluster(t *testing.T) {
-	cluster := rancher.Cluster{
+	cluster := source.Cluster{
 		ID:                 "id",
 		Name:               "name",
 		KubeConfigContents: "some stuff",
@@ -32,4 +39,296 @@ func TestNewVerrazzanoManagedCluster(t *testing.T) {
 	if c.Spec.Type != "oke" {
 		t.Fatalf("expected Spec.Type to be %s, but got %s", "oke", c.Spec.Type)
 	}
+	if !HasFinalizer(c) {
+		t.Fatalf("expected finalizer %s, but got %v", constants.ManagedClusterFinalizer, c.Finalizers)
+	}
+}
+
+func TestCreateVerrazzanoManagedClusterDryRun(t *testing.T) {
+	cluster := newTestCluster()
+	clientSet := fakeclientset.NewSimpleClientset()
+	lister := testutil.NewVerrazzanoManagedClusterLister(t)
+	plan := &Plan{}
+
+	_, err := CreateVerrazzanoManagedCluster(clientSet, lister, cluster, Options{DryRun: true, Plan: plan})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clientSet.Actions()) != 0 {
+		t.Fatalf("expected no API calls in dry-run mode, got %v", clientSet.Actions())
+	}
+	changes := plan.Changes()
+	if len(changes) != 1 || changes[0].Action != ActionCreate || changes[0].Kind != "VerrazzanoManagedCluster" || changes[0].Name != cluster.Name {
+		t.Fatalf("unexpected planned changes %+v", changes)
+	}
+}
+
+func TestUpdateVerrazzanoManagedClusterKeepsForeignDescription(t *testing.T) {
+	cluster := newTestCluster()
+	existing := newVerrazzanoManagedCluster(cluster)
+	existing.Spec.Description = "set by someone else"
+	existing.Spec.ServerAddress = "1.1.1.1:6443"
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+	patches := addApplyReactor(&clientSet.Fake, "verrazzanomanagedclusters")
+
+	_, err := CreateVerrazzanoManagedCluster(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, existing), cluster, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single apply call, got %v", clientSet.Actions())
+	}
+	spec := decodePatch(t, (*patches)[0])["spec"].(map[string]interface{})
+	if spec["serverAddress"] != cluster.ServerAddress {
+		t.Fatalf("expected serverAddress %s in apply patch, got %v", cluster.ServerAddress, spec)
+	}
+	if _, ok := spec["description"]; ok {
+		t.Fatalf("expected description not to be owned by the operator, got %v", spec)
+	}
+}
+
+func TestCreateVerrazzanoManagedClusterOmitsDescription(t *testing.T) {
+	cluster := newTestCluster()
+	clientSet := fakeclientset.NewSimpleClientset()
+	patches := addApplyReactor(&clientSet.Fake, "verrazzanomanagedclusters")
+
+	if _, err := CreateVerrazzanoManagedCluster(clientSet, testutil.NewVerrazzanoManagedClusterLister(t), cluster, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single apply call, got %v", clientSet.Actions())
+	}
+	spec := decodePatch(t, (*patches)[0])["spec"].(map[string]interface{})
+	if _, ok := spec["description"]; ok {
+		t.Fatalf("expected the created resource not to own description, got %v", spec)
+	}
+}
+
+func TestRemoveFinalizer(t *testing.T) {
+	existing := newVerrazzanoManagedCluster(newTestCluster())
+	existing.Finalizers = append(existing.Finalizers, "other")
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+
+	err := RemoveFinalizer(clientSet, existing, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), existing.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if HasFinalizer(updated) || len(updated.Finalizers) != 1 || updated.Finalizers[0] != "other" {
+		t.Fatalf("expected only the operator's finalizer to be removed, got %v", updated.Finalizers)
+	}
+}
+
+func TestRemoveFinalizerFromStaleCopy(t *testing.T) {
+	stale := newVerrazzanoManagedCluster(newTestCluster())
+	stale.ResourceVersion = "1"
+
+	// Other writes since the copy was listed don't conflict
+	current := stale.DeepCopy()
+	current.ResourceVersion = "2"
+	current.Annotations = map[string]string{constants.HealthStatusAnnotation: "Healthy"}
+	clientSet := fakeclientset.NewSimpleClientset(current)
+	if err := RemoveFinalizer(clientSet, stale, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated, err := clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), stale.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if HasFinalizer(updated) || updated.Annotations[constants.HealthStatusAnnotation] != "Healthy" {
+		t.Fatalf("expected only the finalizer to be removed, got %v", updated.ObjectMeta)
+	}
+
+	// A concurrent change of the finalizers fails the patch instead of removing another finalizer
+	current = stale.DeepCopy()
+	current.Finalizers = append([]string{"other"}, current.Finalizers...)
+	clientSet = fakeclientset.NewSimpleClientset(current)
+	if err = RemoveFinalizer(clientSet, stale, Options{}); err == nil {
+		t.Fatalf("expected a concurrent change of the finalizers to fail the patch")
+	}
+}
+
+func TestPruneVerrazzanoManagedClusters(t *testing.T) {
+	kept := newVerrazzanoManagedCluster(newTestCluster())
+	deregistered := newVerrazzanoManagedCluster(source.Cluster{ID: "old", Name: "old"})
+	foreign := newVerrazzanoManagedCluster(source.Cluster{ID: "foreign", Name: "foreign"})
+	foreign.Labels = nil
+	clientSet := fakeclientset.NewSimpleClientset(kept, deregistered, foreign)
+
+	pruned, err := PruneVerrazzanoManagedClusters(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, kept, deregistered, foreign), []source.Cluster{newTestCluster()}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0] != "old" {
+		t.Fatalf("expected only the deregistered cluster to be pruned, got %v", pruned)
+	}
+	remaining, err := clientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(remaining.Items) != 2 {
+		t.Fatalf("expected 2 remaining VerrazzanoManagedClusters, got %d", len(remaining.Items))
+	}
+}
+
+func TestPruneVerrazzanoManagedClustersByID(t *testing.T) {
+	// A renamed cluster keeps its ID, its resource is not pruned although its name is no longer current
+	renamedCluster := newTestCluster()
+	renamedCluster.Name = "previous-name"
+	renamed := newVerrazzanoManagedCluster(renamedCluster)
+	// A cluster whose name was taken over by another cluster is pruned
+	replaced := newVerrazzanoManagedCluster(source.Cluster{ID: "replaced", Name: "reused"})
+	clientSet := fakeclientset.NewSimpleClientset(renamed, replaced)
+
+	clusters := []source.Cluster{newTestCluster(), {ID: "new", Name: "reused"}}
+	pruned, err := PruneVerrazzanoManagedClusters(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, renamed, replaced), clusters, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0] != "reused" {
+		t.Fatalf("expected only the replaced cluster to be pruned, got %v", pruned)
+	}
+}
+
+func TestCreateVerrazzanoManagedClusterOfOtherCluster(t *testing.T) {
+	existing := newVerrazzanoManagedCluster(source.Cluster{ID: "other", Name: "name"})
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+
+	if _, err := CreateVerrazzanoManagedCluster(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, existing), newTestCluster(), Options{}); err == nil {
+		t.Fatalf("expected an error for a name used by another cluster")
+	}
+}
+
+func TestRenamedVerrazzanoManagedClusters(t *testing.T) {
+	previousCluster := newTestCluster()
+	previousCluster.Name = "previous-name"
+	previous := newVerrazzanoManagedCluster(previousCluster)
+	current := newVerrazzanoManagedCluster(newTestCluster())
+	lister := testutil.NewVerrazzanoManagedClusterLister(t, previous, current)
+
+	renamed, err := GetRenamedVerrazzanoManagedClusters(lister, newTestCluster())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(renamed) != 1 || renamed[0].Name != "previous-name" {
+		t.Fatalf("expected the resource of the previous name, got %v", renamed)
+	}
+
+	previousSecret := newSecret(util.GetManagedClusterKubeconfigSecretName(previousCluster.Name), previousCluster)
+	sdoClientSet := fakeclientset.NewSimpleClientset(previous, current)
+	kubeClientSet := fake.NewSimpleClientset(previousSecret)
+	if err = RetireVerrazzanoManagedCluster(sdoClientSet, kubeClientSet, previous, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = sdoClientSet.VerrazzanoV1beta1().VerrazzanoManagedClusters(constants.DefaultNamespace).Get(context.TODO(), previous.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the previous VerrazzanoManagedCluster to be deleted, got %v", err)
+	}
+	if _, err = kubeClientSet.CoreV1().Secrets(constants.DefaultNamespace).Get(context.TODO(), previousSecret.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected the previous secret to be deleted, got %v", err)
+	}
+
+	// The resource of a cluster is found by its ID
+	if found, err := FindVerrazzanoManagedCluster(testutil.NewVerrazzanoManagedClusterLister(t, current), source.Cluster{ID: "id", Name: "unknown-name"}); err != nil || found.Name != current.Name {
+		t.Fatalf("expected the resource of the cluster ID, got %v and error %v", found, err)
+	}
+}
+
+func TestNewVerrazzanoManagedClusterNamingRules(t *testing.T) {
+	cluster := newTestCluster()
+	cluster.SecretName = "name-kubeconfig"
+	cluster.ResourceLabels = map[string]string{"region": "phx", constants.VerrazzanoClusterLabel: "other"}
+	cluster.ResourceAnnotations = map[string]string{"example.com/owner": "team"}
+
+	tmc := newVerrazzanoManagedCluster(cluster)
+	if tmc.Spec.KubeconfigSecret != "name-kubeconfig" {
+		t.Fatalf("expected the secret name of the naming rules, got %s", tmc.Spec.KubeconfigSecret)
+	}
+	if tmc.Labels["region"] != "phx" || tmc.Labels[constants.VerrazzanoClusterLabel] != "name" {
+		t.Fatalf("expected the labels of the naming rules without overriding the operator's labels, got %v", tmc.Labels)
+	}
+	if tmc.Annotations["example.com/owner"] != "team" {
+		t.Fatalf("expected the annotations of the naming rules, got %v", tmc.Annotations)
+	}
+}
+
+func TestUpdateVerrazzanoManagedClusterRemovesStaleLabels(t *testing.T) {
+	previous := newTestCluster()
+	previous.ResourceLabels = map[string]string{"region": "phx", "team": "blue"}
+	existing := newVerrazzanoManagedCluster(previous)
+	if existing.Annotations[constants.GeneratedLabelsAnnotation] != "region,team" {
+		t.Fatalf("expected the generated labels to be recorded, got %v", existing.Annotations)
+	}
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+	patches := addApplyReactor(&clientSet.Fake, "verrazzanomanagedclusters")
+
+	// The team label is no longer propagated, although it is no difference to the remaining labels
+	cluster := newTestCluster()
+	cluster.ResourceLabels = map[string]string{"region": "phx"}
+	_, err := CreateVerrazzanoManagedCluster(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, existing), cluster, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single apply call, got %v", clientSet.Actions())
+	}
+	metadata := decodePatch(t, (*patches)[0])["metadata"].(map[string]interface{})
+	if _, ok := metadata["labels"].(map[string]interface{})["team"]; ok {
+		t.Fatalf("expected the stale label to be left out of the apply patch, got %v", metadata)
+	}
+	if metadata["annotations"].(map[string]interface{})[constants.GeneratedLabelsAnnotation] != "region" {
+		t.Fatalf("expected the generated labels to be updated, got %v", metadata)
+	}
+}
+
+func TestCreateVerrazzanoManagedClusterPaused(t *testing.T) {
+	cluster := newTestCluster()
+	existing := newVerrazzanoManagedCluster(cluster)
+	existing.Spec.ServerAddress = "1.1.1.1:6443"
+	existing.Annotations = map[string]string{constants.PausedAnnotation: "true"}
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+
+	tmc, err := CreateVerrazzanoManagedCluster(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, existing), cluster, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clientSet.Actions()) != 0 || tmc.Spec.ServerAddress != "1.1.1.1:6443" {
+		t.Fatalf("expected a paused VerrazzanoManagedCluster to be left alone, got %v", clientSet.Actions())
+	}
+
+	// Nor is it pruned once its cluster is deregistered
+	pruned, err := PruneVerrazzanoManagedClusters(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, existing), nil, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pruned) != 0 || len(clientSet.Actions()) != 0 {
+		t.Fatalf("expected a paused VerrazzanoManagedCluster not to be pruned, got %v", pruned)
+	}
+}
+
+func TestCreateVerrazzanoManagedClusterServerAddressOverride(t *testing.T) {
+	cluster := newTestCluster()
+	existing := newVerrazzanoManagedCluster(cluster)
+	existing.Annotations = map[string]string{constants.ServerAddressOverrideAnnotation: "lb.example.com:6443"}
+	clientSet := fakeclientset.NewSimpleClientset(existing)
+	patches := addApplyReactor(&clientSet.Fake, "verrazzanomanagedclusters")
+
+	if _, err := CreateVerrazzanoManagedCluster(clientSet, testutil.NewVerrazzanoManagedClusterLister(t, existing), cluster, Options{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single apply call, got %v", clientSet.Actions())
+	}
+	spec := decodePatch(t, (*patches)[0])["spec"].(map[string]interface{})
+	if spec["serverAddress"] != "lb.example.com:6443" {
+		t.Fatalf("expected the overridden serverAddress in apply patch, got %v", spec)
+	}
+
+	// An invalid override is ignored
+	existing.Annotations[constants.ServerAddressOverrideAnnotation] = "not an address"
+	if address := GetServerAddressOverride(existing); address != "" {
+		t.Fatalf("expected an invalid override to be ignored, got %s", address)
+	}
 }
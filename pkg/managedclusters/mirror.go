@@ -0,0 +1,226 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles the copies of VerrazzanoManagedCluster secrets in other namespaces
+
+package managedclusters
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	listers "github.com/verrazzano/verrazzano-crd-generator/pkg/client/listers/verrazzano/v1beta1"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+)
+
+// SyncMirroredSecrets copies the kubeconfig secrets of the VerrazzanoManagedClusters into the given namespaces, or the
+// subset of them selected by the MirrorNamespacesAnnotation of each resource, using server-side apply.  Copies in other
+// namespaces, or of secrets that no longer exist, are deleted.  Namespaces failing to sync don't stop the others, their
+// errors are aggregated.
+func SyncMirroredSecrets(kubeClientSet kubernetes.Interface, secretLister corev1listers.SecretLister, tmcLister listers.VerrazzanoManagedClusterLister, namespaces []string, opts Options) error {
+	mirrors, err := listMirroredSecrets(kubeClientSet)
+	if err != nil {
+		return err
+	}
+	// Existing copies by secret and namespace
+	existing := map[string]map[string]*corev1.Secret{}
+	for i := range mirrors {
+		sourceKey := mirrors[i].Annotations[constants.MirrorSourceAnnotation]
+		if existing[sourceKey] == nil {
+			existing[sourceKey] = map[string]*corev1.Secret{}
+		}
+		existing[sourceKey][mirrors[i].Namespace] = &mirrors[i]
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{constants.K8SAppLabel: constants.VerrazzanoGroup})
+	tmcs, err := tmcLister.VerrazzanoManagedClusters(constants.DefaultNamespace).List(selector)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, tmc := range tmcs {
+		if tmc.DeletionTimestamp != nil {
+			continue
+		}
+		secret, err := secretLister.Secrets(tmc.Namespace).Get(tmc.Spec.KubeconfigSecret)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sourceKey := secret.Namespace + "/" + secret.Name
+		mirrorNamespaces, rejected := GetMirrorNamespaces(namespaces, tmc.Annotations)
+		if len(rejected) > 0 {
+			zap.S().Warnf("Not mirroring the secret %s of the VerrazzanoManagedCluster %s into the namespaces %v, which aren't allowed by the mirror namespaces of the operator", secret.Name, tmc.Name, rejected)
+		}
+		if err = mirrorSecret(kubeClientSet, secret, existing[sourceKey], mirrorNamespaces, opts); err != nil {
+			errs = append(errs, err)
+		}
+		delete(existing, sourceKey)
+	}
+
+	// The remaining copies are of secrets that are gone, or no longer belong to a VerrazzanoManagedCluster
+	for _, copies := range existing {
+		for _, mirror := range copies {
+			if err = deleteMirroredSecret(kubeClientSet, mirror, opts); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Copies a secret into the given namespaces, and deletes its existing copies, by namespace, from other namespaces
+func mirrorSecret(kubeClientSet kubernetes.Interface, secret *corev1.Secret, existing map[string]*corev1.Secret, namespaces []string, opts Options) error {
+	var errs []error
+	wanted := map[string]bool{}
+	for _, namespace := range namespaces {
+		if namespace == secret.Namespace || wanted[namespace] {
+			continue
+		}
+		wanted[namespace] = true
+		if err := applyMirroredSecret(kubeClientSet, secret, existing[namespace], namespace, opts); err != nil {
+			zap.S().Errorf("Failed to mirror VerrazzanoManagedCluster Secret '%s' into namespace '%s', for the reason (%v)", secret.Name, namespace, err)
+			errs = append(errs, err)
+		}
+	}
+	for namespace, mirror := range existing {
+		if wanted[namespace] {
+			continue
+		}
+		if err := deleteMirroredSecret(kubeClientSet, mirror, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Lists the copies of VerrazzanoManagedCluster secrets in all namespaces.  The API is used rather than a lister, since
+// the operator may be watching a single namespace.
+func listMirroredSecrets(kubeClientSet kubernetes.Interface) ([]corev1.Secret, error) {
+	selector := labels.SelectorFromSet(labels.Set{constants.MirroredSecretLabel: "true"})
+	list, err := kubeClientSet.CoreV1().Secrets(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// Creates/updates the copy of a secret in the given namespace, unless up to date.  A secret of the same name that
+// isn't a copy is left alone.
+func applyMirroredSecret(kubeClientSet kubernetes.Interface, secret *corev1.Secret, existing *corev1.Secret, namespace string, opts Options) error {
+	mirror := newMirroredSecret(secret, namespace)
+	if existing == nil {
+		other, err := kubeClientSet.CoreV1().Secrets(namespace).Get(context.TODO(), secret.Name, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && other.Labels[constants.MirroredSecretLabel] != "true" {
+			return fmt.Errorf("secret %s/%s exists and is not a mirror", namespace, secret.Name)
+		}
+		zap.S().Infof("Mirroring VerrazzanoManagedCluster Secret '%s' into namespace '%s'", secret.Name, namespace)
+		if opts.DryRun {
+			opts.record(ActionCreate, "Secret", mirror.ObjectMeta, redactedSecretDiff(nil, mirror))
+		}
+	} else {
+		specDiffs := redactedSecretDiff(existing, mirror)
+		if specDiffs == "" {
+			return nil
+		}
+		zap.S().Infof("Updating mirror of VerrazzanoManagedCluster Secret '%s' in namespace '%s'", secret.Name, namespace)
+		if opts.DryRun {
+			opts.record(ActionUpdate, "Secret", mirror.ObjectMeta, specDiffs)
+		}
+	}
+	if opts.skipAPICall() {
+		return nil
+	}
+	patch, err := toApplyPatch(mirror, corev1.SchemeGroupVersion.WithKind("Secret"))
+	if err != nil {
+		return err
+	}
+	_, err = kubeClientSet.CoreV1().Secrets(namespace).Patch(context.TODO(), mirror.Name, types.ApplyPatchType, patch, opts.applyOptions())
+	return err
+}
+
+// Deletes the copy of a secret
+func deleteMirroredSecret(kubeClientSet kubernetes.Interface, mirror *corev1.Secret, opts Options) error {
+	zap.S().Infof("Deleting mirror of VerrazzanoManagedCluster Secret '%s' in namespace '%s'", mirror.Name, mirror.Namespace)
+	if opts.DryRun {
+		opts.record(ActionDelete, "Secret", mirror.ObjectMeta, "")
+		if opts.skipAPICall() {
+			return nil
+		}
+	}
+	err := kubeClientSet.CoreV1().Secrets(mirror.Namespace).Delete(context.TODO(), mirror.Name, metav1.DeleteOptions{DryRun: opts.dryRunValues()})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Constructs the copy of a secret in the given namespace
+func newMirroredSecret(secret *corev1.Secret, namespace string) *corev1.Secret {
+	mirrorLabels := map[string]string{}
+	for key, value := range secret.Labels {
+		mirrorLabels[key] = value
+	}
+	mirrorLabels[constants.MirroredSecretLabel] = "true"
+	// Copies of secrets whose kubeconfig is kept in an external backend reference it the same way
+	mirrorAnnotations := map[string]string{constants.MirrorSourceAnnotation: secret.Namespace + "/" + secret.Name}
+	for _, key := range []string{constants.KubeconfigLocationAnnotation, constants.KubeconfigChecksumAnnotation} {
+		if value, ok := secret.Annotations[key]; ok {
+			mirrorAnnotations[key] = value
+		}
+	}
+	return &corev1.Secret{
+		Type: secret.Type,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secret.Name,
+			Namespace:   namespace,
+			Labels:      mirrorLabels,
+			Annotations: mirrorAnnotations,
+		},
+		Data: secret.Data,
+	}
+}
+
+// GetMirrorNamespaces returns the namespaces the kubeconfig secret of a VerrazzanoManagedCluster is mirrored into.  The
+// given namespaces are the allowlist of the operator: without a MirrorNamespacesAnnotation the secret is mirrored into
+// all of them, otherwise only into the annotated namespaces that are in the allowlist.  Annotated namespaces outside
+// the allowlist are returned as rejected, since anyone able to annotate the resource could otherwise have the secret
+// copied into any namespace.
+func GetMirrorNamespaces(namespaces []string, annotations map[string]string) (result []string, rejected []string) {
+	annotation, ok := annotations[constants.MirrorNamespacesAnnotation]
+	if !ok {
+		return append([]string{}, namespaces...), nil
+	}
+	allowed := map[string]bool{}
+	for _, namespace := range namespaces {
+		allowed[namespace] = true
+	}
+	result = []string{}
+	for _, namespace := range strings.Split(annotation, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace == "" {
+			continue
+		}
+		if allowed[namespace] {
+			result = append(result, namespace)
+		} else {
+			rejected = append(rejected, namespace)
+		}
+	}
+	return result, rejected
+}
@@ -0,0 +1,102 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package managedclusters
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestSyncMirroredSecrets(t *testing.T) {
+	cluster := newTestCluster()
+	tmc := newVerrazzanoManagedCluster(cluster)
+	tmc.Annotations = map[string]string{constants.MirrorNamespacesAnnotation: "global, shared, kube-system"}
+	secret := newSecret(tmc.Spec.KubeconfigSecret, cluster)
+
+	// A copy in a namespace no longer configured, an up to date copy, and a copy of a secret that is gone.  The
+	// annotation selects global and shared of the allowed namespaces, kube-system isn't allowed and other isn't selected.
+	stale := newMirroredSecret(secret, "removed")
+	current := newMirroredSecret(secret, "shared")
+	orphanSecret := newSecret("verrazzano-managed-cluster-gone", source.Cluster{ID: "gone", Name: "gone"})
+	orphan := newMirroredSecret(orphanSecret, "shared")
+	kubeClientSet := fake.NewSimpleClientset(stale, current, orphan)
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	err := SyncMirroredSecrets(kubeClientSet, testutil.NewSecretLister(t, secret), testutil.NewVerrazzanoManagedClusterLister(t, tmc), []string{"global", "shared", "other", constants.DefaultNamespace}, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var applied []string
+	for _, patch := range *patches {
+		applied = append(applied, patch.GetNamespace())
+		metadata := decodePatch(t, patch)["metadata"].(map[string]interface{})
+		if metadata["annotations"].(map[string]interface{})[constants.MirrorSourceAnnotation] != constants.DefaultNamespace+"/"+secret.Name {
+			t.Fatalf("expected the source to be recorded on the copy, got %v", metadata)
+		}
+	}
+	sort.Strings(applied)
+	if len(applied) != 1 || applied[0] != "global" {
+		t.Fatalf("expected a copy to be applied into namespace global, got %v", applied)
+	}
+
+	var deleted []string
+	for _, action := range kubeClientSet.Actions() {
+		if deleteAction, ok := action.(k8stesting.DeleteAction); ok && action.GetVerb() == "delete" {
+			deleted = append(deleted, deleteAction.GetNamespace()+"/"+deleteAction.GetName())
+		}
+	}
+	sort.Strings(deleted)
+	if len(deleted) != 2 || deleted[0] != "removed/"+secret.Name || deleted[1] != "shared/"+orphanSecret.Name {
+		t.Fatalf("expected the stale and orphaned copies to be deleted, got %v", deleted)
+	}
+}
+
+func TestGetMirrorNamespaces(t *testing.T) {
+	allowed := []string{"global", "shared"}
+	namespaces, rejected := GetMirrorNamespaces(allowed, nil)
+	if len(namespaces) != 2 || len(rejected) != 0 {
+		t.Fatalf("expected all the allowed namespaces without the annotation, got %v and rejected %v", namespaces, rejected)
+	}
+	namespaces, rejected = GetMirrorNamespaces(allowed, map[string]string{constants.MirrorNamespacesAnnotation: "shared, kube-system"})
+	if len(namespaces) != 1 || namespaces[0] != "shared" {
+		t.Fatalf("expected only the allowed namespace of the annotation, got %v", namespaces)
+	}
+	if len(rejected) != 1 || rejected[0] != "kube-system" {
+		t.Fatalf("expected the namespace outside the allowlist to be rejected, got %v", rejected)
+	}
+	namespaces, _ = GetMirrorNamespaces(nil, map[string]string{constants.MirrorNamespacesAnnotation: "kube-system"})
+	if len(namespaces) != 0 {
+		t.Fatalf("expected no namespaces without an allowlist, got %v", namespaces)
+	}
+}
+
+func TestSyncMirroredSecretsLeavesOtherSecrets(t *testing.T) {
+	cluster := newTestCluster()
+	tmc := newVerrazzanoManagedCluster(cluster)
+	secret := newSecret(tmc.Spec.KubeconfigSecret, cluster)
+	other := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Namespace: "taken"}}
+	kubeClientSet := fake.NewSimpleClientset(other)
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	err := SyncMirroredSecrets(kubeClientSet, testutil.NewSecretLister(t, secret), testutil.NewVerrazzanoManagedClusterLister(t, tmc), []string{"taken"}, Options{})
+	if err == nil {
+		t.Fatalf("expected an error for a secret that isn't a copy")
+	}
+	if len(*patches) != 0 {
+		t.Fatalf("expected no apply calls, got %v", *patches)
+	}
+	if _, err = kubeClientSet.CoreV1().Secrets("taken").Get(context.TODO(), secret.Name, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the other secret to be left alone, got %v", err)
+	}
+}
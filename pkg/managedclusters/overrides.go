@@ -0,0 +1,41 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles the annotations users override the reconciliation of a VerrazzanoManagedCluster with
+
+package managedclusters
+
+import (
+	"net"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	"go.uber.org/zap"
+)
+
+// IsPaused returns true if the VerrazzanoManagedCluster is annotated to be left alone
+func IsPaused(tmc *v1beta1.VerrazzanoManagedCluster) bool {
+	return tmc != nil && tmc.Annotations[constants.PausedAnnotation] == "true"
+}
+
+// IsKubeconfigPinned returns true if the VerrazzanoManagedCluster is annotated to keep its stored kubeconfig
+func IsKubeconfigPinned(tmc *v1beta1.VerrazzanoManagedCluster) bool {
+	return tmc != nil && tmc.Annotations[constants.PinKubeconfigAnnotation] == "true"
+}
+
+// GetServerAddressOverride returns the server address the VerrazzanoManagedCluster is annotated with, or an empty
+// string if it has none or an invalid one
+func GetServerAddressOverride(tmc *v1beta1.VerrazzanoManagedCluster) string {
+	if tmc == nil {
+		return ""
+	}
+	address, ok := tmc.Annotations[constants.ServerAddressOverrideAnnotation]
+	if !ok || address == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		zap.S().Errorf("Ignoring invalid %s annotation '%s' of VerrazzanoManagedCluster CR '%s', for the reason (%v)", constants.ServerAddressOverrideAnnotation, address, tmc.Name, err)
+		return ""
+	}
+	return address
+}
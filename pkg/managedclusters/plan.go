@@ -0,0 +1,140 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles dry-run planning of changes to VerrazzanoManagedClusters and their secrets
+
+package managedclusters
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/secretbackend"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/diff"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Action is the kind of change the operator intends to make to a resource
+type Action string
+
+// Planned actions
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// Change describes a single intended change to a resource
+type Change struct {
+	Action    Action `json:"action"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+// Plan collects the changes the operator would make when running in dry-run mode
+type Plan struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+// Options controls how changes to managed cluster resources are applied
+type Options struct {
+	// DryRun computes and records changes in Plan without mutating the cluster
+	DryRun bool
+	// ServerDryRun sends dry-run requests to the API server so admission is still validated
+	ServerDryRun bool
+	// Plan receives the changes computed in dry-run mode, may be nil
+	Plan *Plan
+	// Rotation is the rotation policy of kubeconfig secret credentials
+	Rotation RotationPolicy
+	// Backend stores the kubeconfigs of the secrets, they are kept in the secrets if nil
+	Backend secretbackend.SecretBackend
+}
+
+// backend returns the secret backend of the options
+func (o Options) backend() secretbackend.SecretBackend {
+	if o.Backend == nil {
+		return secretbackend.Kubernetes{}
+	}
+	return o.Backend
+}
+
+// Add records a change in the plan
+func (p *Plan) Add(change Change) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, change)
+}
+
+// Changes returns a copy of the changes recorded in the plan
+func (p *Plan) Changes() []Change {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Change(nil), p.changes...)
+}
+
+// Log writes the plan as a structured log entry
+func (p *Plan) Log() {
+	changes := p.Changes()
+	if len(changes) == 0 {
+		zap.S().Infow("Dry-run plan: no changes")
+		return
+	}
+	planJSON, err := json.Marshal(changes)
+	if err != nil {
+		zap.S().Errorf("Failed to marshal dry-run plan, for the reason (%v)", err)
+		return
+	}
+	zap.S().Infow("Dry-run plan", "changes", len(changes), "plan", string(planJSON))
+}
+
+// record adds a change to the plan of the given options and logs it
+func (o Options) record(action Action, kind string, meta metav1.ObjectMeta, specDiffs string) {
+	zap.S().Infow("Dry-run: skipping change", "action", action, "kind", kind, "namespace", meta.Namespace, "name", meta.Name)
+	o.Plan.Add(Change{Action: action, Kind: kind, Namespace: meta.Namespace, Name: meta.Name, Diff: specDiffs})
+}
+
+// dryRunValues returns the DryRun values to send with API requests
+func (o Options) dryRunValues() []string {
+	if o.DryRun && o.ServerDryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// skipAPICall returns true if no API call is to be made for a change
+func (o Options) skipAPICall() bool {
+	return o.DryRun && !o.ServerDryRun
+}
+
+// redactedSecretDiff compares two secrets with their data replaced by checksums, so that plans never
+// contain secret material
+func redactedSecretDiff(liveSecret *corev1.Secret, desiredSecret *corev1.Secret) string {
+	return diff.CompareIgnoreTargetEmpties(redactSecret(liveSecret), redactSecret(desiredSecret))
+}
+
+// Returns a copy of the secret with its data replaced by checksums in StringData
+func redactSecret(secret *corev1.Secret) *corev1.Secret {
+	if secret == nil {
+		return &corev1.Secret{}
+	}
+	redacted := secret.DeepCopy()
+	redacted.Data = nil
+	redacted.StringData = map[string]string{}
+	for key, value := range secret.Data {
+		redacted.StringData[key] = fmt.Sprintf("<redacted sha256:%x>", sha256.Sum256(value))
+	}
+	return redacted
+}
@@ -0,0 +1,175 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles the rotation policy of kubeconfig secret credentials
+
+package managedclusters
+
+import (
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/secretbackend"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// RotationPolicy controls when the credentials of a kubeconfig secret are rotated
+type RotationPolicy struct {
+	// MaxAge is the maximum age of the credentials, zero keeps them until they are missing or invalid
+	MaxAge time.Duration
+	// Window is the period before MaxAge during which credentials are rotated, at a stable per-cluster offset so
+	// that the rotation of many clusters is spread out
+	Window time.Duration
+	// MinOverlap is how long superseded credentials remain valid after a rotation before they are revoked
+	MinOverlap time.Duration
+}
+
+// Validate checks that the rotation policy is usable
+func (p RotationPolicy) Validate() error {
+	if p.MaxAge < 0 || p.Window < 0 || p.MinOverlap < 0 {
+		return errors.New("kubeconfig rotation durations must not be negative")
+	}
+	if p.Window > p.MaxAge {
+		return errors.New("kubeconfig rotation window must not exceed the maximum credential age")
+	}
+	return nil
+}
+
+// Rotation is the outcome of applying the rotation policy to the kubeconfig secret of a cluster
+type Rotation struct {
+	// Rotated is true if previously stored credentials were replaced
+	Rotated bool
+	// RevokeTokens are Rancher tokens that are no longer used and are to be revoked
+	RevokeTokens []string
+
+	cluster     source.Cluster
+	annotations map[string]string
+}
+
+// planRotation decides which credentials the kubeconfig secret of the cluster holds, given the existing secret.  The
+// policy applies to the credentials minted for the operator, such as Rancher tokens, which differ on every poll.  Other
+// credentials are owned by the cluster source and replaced as soon as they change.  Pinned credentials are kept
+// regardless.
+func planRotation(existing *corev1.Secret, cluster source.Cluster, policy RotationPolicy, pinned bool, now time.Time) Rotation {
+	rotation := Rotation{cluster: cluster, annotations: map[string]string{}}
+	rotatedAt := now
+
+	if existing != nil {
+		storedKubeconfig := string(existing.Data[constants.KubeconfigSecretKey])
+		storedTokenName := GetSecretTokenName(existing)
+		storedRotatedAt := getRotatedAt(existing)
+
+		// A cluster without a kubeconfig had its generation skipped, because the stored credentials are kept
+		minted := cluster.TokenName != ""
+		keep := storedKubeconfig == cluster.KubeConfigContents || cluster.KubeConfigContents == "" ||
+			(storedKubeconfig != "" && (pinned || (minted && isValidKubeconfig(storedKubeconfig) && !policy.due(cluster, storedRotatedAt, now))))
+		if keep {
+			// Keep the stored credentials, the ones just generated are unused
+			if cluster.TokenName != storedTokenName {
+				rotation.revoke(cluster.TokenName)
+			}
+			rotation.cluster.KubeConfigContents = storedKubeconfig
+			rotation.cluster.TokenName = storedTokenName
+			rotatedAt = storedRotatedAt
+			rotation.keepSupersededToken(existing, now)
+		} else {
+			rotation.Rotated = storedKubeconfig != ""
+			// A rotation while an earlier superseded token is pending revocation ends its overlap early
+			rotation.revoke(existing.Annotations[constants.SupersededTokenAnnotation])
+			if storedTokenName != cluster.TokenName {
+				rotation.supersede(storedTokenName, policy, now)
+			}
+		}
+	}
+
+	rotation.annotations[constants.KubeconfigRotatedAtAnnotation] = rotatedAt.UTC().Format(time.RFC3339)
+	if policy.MaxAge > 0 {
+		rotation.annotations[constants.KubeconfigNextRotationAnnotation] = policy.nextRotation(cluster, rotatedAt).UTC().Format(time.RFC3339)
+	}
+	if rotation.cluster.TokenName != "" {
+		rotation.annotations[constants.RancherTokenAnnotation] = rotation.cluster.TokenName
+	}
+	return rotation
+}
+
+// IsKubeconfigCurrent returns true if the rotation policy keeps the minted credentials of the given kubeconfig secret,
+// because they are pinned or valid and not yet due, so that no new credentials need to be minted for the cluster
+func IsKubeconfigCurrent(backend secretbackend.SecretBackend, secret *corev1.Secret, cluster source.Cluster, policy RotationPolicy, pinned bool, now time.Time) bool {
+	kubeconfig, err := ReadKubeconfig(backend, secret)
+	if err != nil || len(kubeconfig) == 0 {
+		return false
+	}
+	return pinned || (isValidKubeconfig(string(kubeconfig)) && !policy.due(cluster, getRotatedAt(secret), now))
+}
+
+// Returns true if credentials issued at the given time are due for rotation, never without a maximum age
+func (p RotationPolicy) due(cluster source.Cluster, rotatedAt time.Time, now time.Time) bool {
+	if p.MaxAge <= 0 {
+		return false
+	}
+	return !now.Before(p.nextRotation(cluster, rotatedAt))
+}
+
+// Returns when credentials issued at the given time are rotated, at a stable offset within the rotation window
+func (p RotationPolicy) nextRotation(cluster source.Cluster, rotatedAt time.Time) time.Time {
+	var offset time.Duration
+	if p.Window > 0 {
+		hash := fnv.New64a()
+		hash.Write([]byte(cluster.ID + "/" + cluster.Name))
+		offset = time.Duration(hash.Sum64() % uint64(p.Window))
+	}
+	return rotatedAt.Add(p.MaxAge - offset)
+}
+
+// Records a token superseded by a rotation, revoking it now or once the overlap has passed
+func (r *Rotation) supersede(tokenName string, policy RotationPolicy, now time.Time) {
+	if tokenName == "" {
+		return
+	}
+	if policy.MinOverlap <= 0 {
+		r.revoke(tokenName)
+		return
+	}
+	r.annotations[constants.SupersededTokenAnnotation] = tokenName
+	r.annotations[constants.SupersededTokenRevokeAfterAnnotation] = now.Add(policy.MinOverlap).UTC().Format(time.RFC3339)
+}
+
+// Carries over a superseded token pending revocation, revoking it if its overlap has passed
+func (r *Rotation) keepSupersededToken(existing *corev1.Secret, now time.Time) {
+	tokenName := existing.Annotations[constants.SupersededTokenAnnotation]
+	if tokenName == "" {
+		return
+	}
+	revokeAfter, err := time.Parse(time.RFC3339, existing.Annotations[constants.SupersededTokenRevokeAfterAnnotation])
+	if err != nil || !now.Before(revokeAfter) {
+		r.revoke(tokenName)
+		return
+	}
+	r.annotations[constants.SupersededTokenAnnotation] = tokenName
+	r.annotations[constants.SupersededTokenRevokeAfterAnnotation] = existing.Annotations[constants.SupersededTokenRevokeAfterAnnotation]
+}
+
+func (r *Rotation) revoke(tokenName string) {
+	if tokenName != "" {
+		r.RevokeTokens = append(r.RevokeTokens, tokenName)
+	}
+}
+
+// Returns true if the stored kubeconfig can still be used to access the cluster
+func isValidKubeconfig(kubeconfig string) bool {
+	_, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	return err == nil
+}
+
+// Returns when the credentials of a kubeconfig secret were issued
+func getRotatedAt(secret *corev1.Secret) time.Time {
+	if rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[constants.KubeconfigRotatedAtAnnotation]); err == nil {
+		return rotatedAt
+	}
+	// Secrets written before rotation was tracked
+	return secret.CreationTimestamp.Time
+}
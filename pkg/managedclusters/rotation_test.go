@@ -0,0 +1,254 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package managedclusters
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Returns a kubeconfig secret for the cluster holding credentials issued at the given time
+func newRotatedSecret(cluster source.Cluster, rotatedAt time.Time) *corev1.Secret {
+	secret := newSecret(util.GetManagedClusterKubeconfigSecretName(cluster.Name), cluster)
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[constants.KubeconfigRotatedAtAnnotation] = rotatedAt.UTC().Format(time.RFC3339)
+	return secret
+}
+
+// Returns a loadable kubeconfig authenticating with the given token
+func testKubeconfig(token string) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://123.123.123.0:1234
+users:
+- name: user
+  user:
+    token: %s
+contexts:
+- name: context
+  context:
+    cluster: cluster
+    user: user
+current-context: context
+`, token)
+}
+
+// Returns a cluster whose kubeconfig was minted with the given token
+func newTokenCluster(kubeconfig string, tokenName string) source.Cluster {
+	cluster := newTestCluster()
+	cluster.KubeConfigContents = testKubeconfig(kubeconfig)
+	cluster.TokenName = tokenName
+	return cluster
+}
+
+func TestPlanRotationNewSecret(t *testing.T) {
+	now := time.Now()
+	cluster := newTokenCluster("kubeconfig-1", "token-1")
+
+	rotation := planRotation(nil, cluster, RotationPolicy{MaxAge: time.Hour}, false, now)
+
+	if rotation.Rotated || len(rotation.RevokeTokens) != 0 {
+		t.Fatalf("expected the first credentials to be stored without rotation, got %+v", rotation)
+	}
+	if rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-1") {
+		t.Fatalf("expected the generated kubeconfig to be stored, got %s", rotation.cluster.KubeConfigContents)
+	}
+	if rotation.annotations[constants.KubeconfigNextRotationAnnotation] != now.Add(time.Hour).UTC().Format(time.RFC3339) {
+		t.Fatalf("unexpected next rotation %s", rotation.annotations[constants.KubeconfigNextRotationAnnotation])
+	}
+}
+
+func TestPlanRotationNotDue(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-30*time.Minute))
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", "token-2"), RotationPolicy{MaxAge: time.Hour}, false, now)
+
+	if rotation.Rotated {
+		t.Fatalf("expected no rotation before the maximum age")
+	}
+	if rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-1") || rotation.cluster.TokenName != "token-1" {
+		t.Fatalf("expected the stored credentials to be kept, got %+v", rotation.cluster)
+	}
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-2"}) {
+		t.Fatalf("expected the unused generated token to be revoked, got %v", rotation.RevokeTokens)
+	}
+}
+
+func TestPlanRotationDue(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-2*time.Hour))
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", "token-2"), RotationPolicy{MaxAge: time.Hour}, false, now)
+
+	if !rotation.Rotated || rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-2") {
+		t.Fatalf("expected the credentials to be rotated, got %+v", rotation)
+	}
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-1"}) {
+		t.Fatalf("expected the superseded token to be revoked, got %v", rotation.RevokeTokens)
+	}
+	if rotation.annotations[constants.KubeconfigRotatedAtAnnotation] != now.UTC().Format(time.RFC3339) {
+		t.Fatalf("expected the rotation time to be recorded, got %v", rotation.annotations)
+	}
+}
+
+func TestPlanRotationOverlap(t *testing.T) {
+	now := time.Now()
+	policy := RotationPolicy{MaxAge: time.Hour, MinOverlap: 10 * time.Minute}
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-2*time.Hour))
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", "token-2"), policy, false, now)
+	if len(rotation.RevokeTokens) != 0 || rotation.annotations[constants.SupersededTokenAnnotation] != "token-1" {
+		t.Fatalf("expected the superseded token to be kept during the overlap, got %+v", rotation)
+	}
+
+	// Within the overlap, the superseded token is carried over
+	rotated := newSecret(existing.Name, rotation.cluster)
+	rotated.Annotations = rotation.annotations
+	rotation = planRotation(rotated, newTokenCluster("kubeconfig-3", "token-3"), policy, false, now.Add(5*time.Minute))
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-3"}) || rotation.annotations[constants.SupersededTokenAnnotation] != "token-1" {
+		t.Fatalf("expected the superseded token to be kept during the overlap, got %+v", rotation)
+	}
+
+	// After the overlap, the superseded token is revoked
+	rotation = planRotation(rotated, newTokenCluster("kubeconfig-3", "token-3"), policy, false, now.Add(15*time.Minute))
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-3", "token-1"}) {
+		t.Fatalf("expected the superseded token to be revoked after the overlap, got %v", rotation.RevokeTokens)
+	}
+	if _, ok := rotation.annotations[constants.SupersededTokenAnnotation]; ok {
+		t.Fatalf("expected the superseded token annotation to be dropped, got %v", rotation.annotations)
+	}
+}
+
+func TestPlanRotationWithoutPolicy(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-48*time.Hour))
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", "token-2"), RotationPolicy{}, false, now)
+
+	if rotation.Rotated || rotation.cluster.TokenName != "token-1" {
+		t.Fatalf("expected valid credentials to be kept without a maximum age, got %+v", rotation)
+	}
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-2"}) {
+		t.Fatalf("expected the unused generated token to be revoked, got %v", rotation.RevokeTokens)
+	}
+}
+
+func TestPlanRotationInvalidKubeconfig(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-time.Minute))
+	existing.Data[constants.KubeconfigSecretKey] = []byte("not a kubeconfig")
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", "token-2"), RotationPolicy{}, false, now)
+
+	if !rotation.Rotated || rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-2") {
+		t.Fatalf("expected invalid credentials to be rotated, got %+v", rotation)
+	}
+}
+
+func TestPlanRotationSourceKubeconfig(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", ""), now.Add(-time.Minute))
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", ""), RotationPolicy{MaxAge: time.Hour}, false, now)
+
+	if !rotation.Rotated || rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-2") {
+		t.Fatalf("expected a changed kubeconfig of the cluster source to be replaced, got %+v", rotation)
+	}
+	if len(rotation.RevokeTokens) != 0 {
+		t.Fatalf("expected no tokens to be revoked, got %v", rotation.RevokeTokens)
+	}
+}
+
+func TestRotationWindow(t *testing.T) {
+	policy := RotationPolicy{MaxAge: 24 * time.Hour, Window: 4 * time.Hour}
+	rotatedAt := time.Now()
+	cluster := newTestCluster()
+
+	next := policy.nextRotation(cluster, rotatedAt)
+	if next.Before(rotatedAt.Add(20*time.Hour)) || next.After(rotatedAt.Add(24*time.Hour)) {
+		t.Fatalf("expected the next rotation to fall in the rotation window, got %v", next.Sub(rotatedAt))
+	}
+	if !next.Equal(policy.nextRotation(cluster, rotatedAt)) {
+		t.Fatalf("expected the rotation offset to be stable")
+	}
+	if err := (RotationPolicy{MaxAge: time.Hour, Window: 2 * time.Hour}).Validate(); err == nil {
+		t.Fatalf("expected a window larger than the maximum age to be rejected")
+	}
+}
+
+func TestPlanRotationPinned(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-2*time.Hour))
+
+	rotation := planRotation(existing, newTokenCluster("kubeconfig-2", "token-2"), RotationPolicy{MaxAge: time.Hour}, true, now)
+
+	if rotation.Rotated || rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-1") {
+		t.Fatalf("expected pinned credentials to be kept past the maximum age, got %+v", rotation)
+	}
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-2"}) {
+		t.Fatalf("expected the unused generated token to be revoked, got %v", rotation.RevokeTokens)
+	}
+}
+
+func TestPlanRotationSkippedKubeconfig(t *testing.T) {
+	now := time.Now()
+	existing := newRotatedSecret(newTokenCluster("kubeconfig-1", "token-1"), now.Add(-30*time.Minute))
+	existing.Annotations[constants.RancherTokenAnnotation] = "token-1"
+	skipped := newTestCluster()
+	skipped.KubeConfigContents = ""
+
+	rotation := planRotation(existing, skipped, RotationPolicy{MaxAge: time.Hour}, false, now)
+
+	if rotation.Rotated || len(rotation.RevokeTokens) != 0 {
+		t.Fatalf("expected the stored credentials to be kept without revocations, got %+v", rotation)
+	}
+	if rotation.cluster.KubeConfigContents != testKubeconfig("kubeconfig-1") || rotation.cluster.TokenName != "token-1" {
+		t.Fatalf("expected the stored credentials to be kept, got %+v", rotation.cluster)
+	}
+}
+
+func TestIsKubeconfigCurrent(t *testing.T) {
+	now := time.Now()
+	cluster := newTokenCluster("kubeconfig-1", "token-1")
+	policy := RotationPolicy{MaxAge: time.Hour}
+	recent := newRotatedSecret(cluster, now.Add(-30*time.Minute))
+	old := newRotatedSecret(cluster, now.Add(-2*time.Hour))
+	invalid := newRotatedSecret(cluster, now.Add(-30*time.Minute))
+	invalid.Data[constants.KubeconfigSecretKey] = []byte("not a kubeconfig")
+	empty := newRotatedSecret(cluster, now.Add(-30*time.Minute))
+	empty.Data[constants.KubeconfigSecretKey] = nil
+
+	tests := []struct {
+		name   string
+		secret *corev1.Secret
+		pinned bool
+		want   bool
+	}{
+		{name: "not due", secret: recent, want: true},
+		{name: "due", secret: old, want: false},
+		{name: "due but pinned", secret: old, pinned: true, want: true},
+		{name: "invalid", secret: invalid, want: false},
+		{name: "empty", secret: empty, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsKubeconfigCurrent(nil, tt.secret, cluster, policy, tt.pinned, now); got != tt.want {
+				t.Errorf("IsKubeconfigCurrent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,84 +7,194 @@ package managedclusters
 
 import (
 	"context"
+	"time"
 
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/rancher"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/secretbackend"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
-	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/diff"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
 	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 )
 
-// CreateSecret creates/updates a VerrazzanoManagedCluster secret
-func CreateSecret(kubeClientSet kubernetes.Interface, secretLister corev1listers.SecretLister, cluster rancher.Cluster) error {
-	secretName := util.GetManagedClusterKubeconfigSecretName(cluster.Name)
+// CreateSecret creates/updates a VerrazzanoManagedCluster secret using server-side apply.  The secret is owned by the
+// given VerrazzanoManagedCluster, if it exists, so that it is garbage collected along with it.  The credentials stored
+// follow the rotation policy of the options, and the returned Rotation lists the Rancher tokens no longer in use.
+func CreateSecret(kubeClientSet kubernetes.Interface, secretLister corev1listers.SecretLister, cluster source.Cluster, owner *v1beta1.VerrazzanoManagedCluster, opts Options) (Rotation, error) {
+	secretName := getSecretName(cluster)
 	zap.S().Debugf("Processing VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
-	newSecret := newSecret(secretName, cluster)
+	if IsPaused(owner) {
+		zap.S().Infof("VerrazzanoManagedCluster CR '%s' is paused, skipping update of Secret '%s'", owner.Name, secretName)
+		rotation := Rotation{}
+		rotation.revoke(cluster.TokenName)
+		return rotation, nil
+	}
 
 	existingSecret, err := secretLister.Secrets(constants.DefaultNamespace).Get(secretName)
+	if err != nil && !errors.IsNotFound(err) {
+		return Rotation{}, err
+	}
+	// After a rename, the credentials and rotation schedule of the secret named after the previous name are migrated
+	previousSecret := existingSecret
+	if existingSecret == nil {
+		if previousSecret, err = FindSecretByClusterID(secretLister, cluster); err != nil {
+			return Rotation{}, err
+		}
+		if previousSecret != nil {
+			zap.S().Infof("Migrating VerrazzanoManagedCluster Secret '%s' of renamed cluster '%s' to '%s'", previousSecret.Name, cluster.Name, secretName)
+		}
+	}
+	backend := opts.backend()
+	storedSecret := previousSecret
+	if previousSecret != nil {
+		if storedSecret, err = withStoredKubeconfig(backend, previousSecret); err != nil {
+			return Rotation{}, err
+		}
+	}
+	rotation := planRotation(storedSecret, cluster, opts.Rotation, IsKubeconfigPinned(owner), time.Now())
+	kubeconfig := []byte(rotation.cluster.KubeConfigContents)
+	newSecret := newSecret(secretName, rotation.cluster)
+	newSecret.Annotations = map[string]string{}
+	for key, value := range getResourceAnnotations(cluster) {
+		newSecret.Annotations[key] = value
+	}
+	for key, value := range rotation.annotations {
+		newSecret.Annotations[key] = value
+	}
+	backend.Encode(newSecret, kubeconfig)
+	if owner != nil && owner.UID != "" {
+		newSecret.OwnerReferences = []metav1.OwnerReference{NewOwnerReference(owner)}
+	}
+
 	if existingSecret != nil {
-		specDiffs := diff.CompareIgnoreTargetEmpties(existingSecret, newSecret)
-		if specDiffs != "" {
-			zap.S().Infof("Updating VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
-			zap.S().Debugf("Spec differences:\n%s", specDiffs)
-			_, err = kubeClientSet.CoreV1().Secrets(constants.DefaultNamespace).Update(context.TODO(), newSecret, metav1.UpdateOptions{})
-		} else {
+		specDiffs := redactedSecretDiff(existingSecret, newSecret) + staleMetadataDiff(existingSecret.ObjectMeta, newSecret.ObjectMeta)
+		if specDiffs == "" {
 			zap.S().Debugf("No need to update existing VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
+			return rotation, nil
+		}
+		zap.S().Infof("Updating VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
+		zap.S().Debugf("Spec differences:\n%s", specDiffs)
+		if opts.DryRun {
+			opts.record(ActionUpdate, "Secret", newSecret.ObjectMeta, specDiffs)
 		}
 	} else {
 		zap.S().Infof("Creating VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
-		_, err = kubeClientSet.CoreV1().Secrets(constants.DefaultNamespace).Create(context.TODO(), newSecret, metav1.CreateOptions{})
+		if opts.DryRun {
+			opts.record(ActionCreate, "Secret", newSecret.ObjectMeta, redactedSecretDiff(nil, newSecret))
+		}
 	}
-	if err != nil {
-		return err
+	if !opts.skipAPICall() {
+		// The kubeconfig is stored before the secret references it
+		if !opts.DryRun {
+			if err = backend.Write(newSecret, kubeconfig); err != nil {
+				return Rotation{}, err
+			}
+		}
+		patch, err := toApplyPatch(newSecret, corev1.SchemeGroupVersion.WithKind("Secret"))
+		if err != nil {
+			return Rotation{}, err
+		}
+		_, err = kubeClientSet.CoreV1().Secrets(constants.DefaultNamespace).Patch(context.TODO(), secretName, types.ApplyPatchType, patch, opts.applyOptions())
+		if err != nil {
+			return Rotation{}, err
+		}
+	}
+	// The secret named after the previous name, or by previous naming rules, is replaced by the new one
+	if existingSecret == nil && previousSecret != nil && previousSecret.Name != secretName {
+		zap.S().Infof("Deleting VerrazzanoManagedCluster Secret '%s' replaced by '%s' for cluster '%s'", previousSecret.Name, secretName, cluster.Name)
+		if opts.DryRun {
+			opts.record(ActionDelete, "Secret", previousSecret.ObjectMeta, "")
+		}
+		if !opts.skipAPICall() {
+			if err = deleteSecret(kubeClientSet, previousSecret, opts); err != nil {
+				return Rotation{}, err
+			}
+		}
+	}
+	if rotation.Rotated {
+		zap.S().Infof("Rotated the credentials of VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
 	}
 
 	zap.S().Debugf("Successfully processed VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
-	return nil
+	return rotation, nil
 }
 
-// DeleteSecret deletes a VerrazzanoManagedCluster secret
-func DeleteSecret(kubeClientSet kubernetes.Interface, secretLister corev1listers.SecretLister, cluster rancher.Cluster) error {
-	secretName := util.GetManagedClusterKubeconfigSecretName(cluster.ID)
-	zap.S().Debugf("Deleting VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
-
-	_, err := secretLister.Secrets(constants.DefaultNamespace).Get(secretName)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			zap.S().Errorf("VerrazzanoManagedCluster Secret `%s` no longer exists for cluster '%s', for the reason (%v)", secretName, cluster.Name, err)
-		}
+// Deletes a VerrazzanoManagedCluster secret along with its kubeconfig in the secret backend
+func deleteSecret(kubeClientSet kubernetes.Interface, secret *corev1.Secret, opts Options) error {
+	err := kubeClientSet.CoreV1().Secrets(secret.Namespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{DryRun: opts.dryRunValues()})
+	if err != nil && !errors.IsNotFound(err) {
 		return err
 	}
+	if opts.DryRun {
+		return nil
+	}
+	return opts.backend().Delete(secret)
+}
 
-	err = kubeClientSet.CoreV1().Secrets(constants.DefaultNamespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})
+// Returns a copy of a VerrazzanoManagedCluster secret holding its kubeconfig read from the secret backend
+func withStoredKubeconfig(backend secretbackend.SecretBackend, secret *corev1.Secret) (*corev1.Secret, error) {
+	kubeconfig, err := backend.Read(secret)
 	if err != nil {
-		zap.S().Errorf("Failed to delete VerrazzanoManagedCluster Secret '%s' for cluster '%s', for the reason (%v)", secretName, cluster.Name, err)
-		return err
+		return nil, err
 	}
+	stored := secret.DeepCopy()
+	stored.Data = map[string][]byte{constants.KubeconfigSecretKey: kubeconfig}
+	return stored, nil
+}
 
-	zap.S().Debugf("Successfully deleted VerrazzanoManagedCluster Secret '%s' for cluster '%s'", secretName, cluster.Name)
-	return nil
+// ReadKubeconfig returns the kubeconfig of a VerrazzanoManagedCluster secret, read from the given secret backend
+func ReadKubeconfig(backend secretbackend.SecretBackend, secret *corev1.Secret) ([]byte, error) {
+	if backend == nil {
+		backend = secretbackend.Kubernetes{}
+	}
+	return backend.Read(secret)
+}
+
+// FindSecretByClusterID finds the VerrazzanoManagedCluster secret of a cluster by the cluster ID label, returns nil if
+// there is none
+func FindSecretByClusterID(secretLister corev1listers.SecretLister, cluster source.Cluster) (*corev1.Secret, error) {
+	selector := labels.SelectorFromSet(labels.Set{constants.ClusterIDLabel: util.GetClusterIDLabelValue(cluster.ID)})
+	secrets, err := secretLister.Secrets(constants.DefaultNamespace).List(selector)
+	if err != nil || len(secrets) == 0 {
+		return nil, err
+	}
+	return secrets[0], nil
 }
 
 // Constructs the secret for the given cluster
-func newSecret(secretName string, cluster rancher.Cluster) *corev1.Secret {
-	return &corev1.Secret{
+func newSecret(secretName string, cluster source.Cluster) *corev1.Secret {
+	secret := &corev1.Secret{
 		Type: corev1.SecretTypeOpaque,
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
 			Namespace: constants.DefaultNamespace,
-			Labels:    util.GetManagedClusterLabels(cluster.Name),
+			Labels:    getResourceLabels(cluster),
 		},
 		Data: map[string][]byte{
 			constants.KubeconfigSecretKey: []byte(cluster.KubeConfigContents),
 		},
 	}
+	if cluster.TokenName != "" {
+		secret.Annotations = map[string]string{constants.RancherTokenAnnotation: cluster.TokenName}
+	}
+	return secret
+}
+
+// GetSecretTokenName returns the name of the Rancher token held by a kubeconfig secret
+func GetSecretTokenName(secret *corev1.Secret) string {
+	if tokenName, ok := secret.Annotations[constants.RancherTokenAnnotation]; ok {
+		return tokenName
+	}
+	// Secrets written before the token was recorded
+	return rancher.GetKubeconfigTokenName(string(secret.Data[constants.KubeconfigSecretKey]))
 }
 
 // GetRancherCACert gets the ca.crt from secret "tls-rancher-ingress" in namespace "cattle-system"
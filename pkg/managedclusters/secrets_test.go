@@ -0,0 +1,329 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package managedclusters
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/secretbackend"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// The fake clientsets don't implement server-side apply, so capture apply patches for the given resource
+// and report them as handled
+func addApplyReactor(fake *k8stesting.Fake, resource string) *[]k8stesting.PatchAction {
+	var patches []k8stesting.PatchAction
+	fake.PrependReactor("patch", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		if patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		patches = append(patches, patchAction)
+		return true, nil, nil
+	})
+	return &patches
+}
+
+// Decodes an apply patch into a map
+func decodePatch(t *testing.T, action k8stesting.PatchAction) map[string]interface{} {
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(action.GetPatch(), &content); err != nil {
+		t.Fatalf("unexpected error decoding patch: %v", err)
+	}
+	return content
+}
+
+func newTestCluster() source.Cluster {
+	return source.Cluster{
+		ID:                 "id",
+		Name:               "name",
+		KubeConfigContents: "super secret kubeconfig",
+		ServerAddress:      "123.123.123.0:1234",
+		Type:               "oke",
+	}
+}
+
+func TestCreateSecretDryRun(t *testing.T) {
+	cluster := newTestCluster()
+	kubeClientSet := fake.NewSimpleClientset()
+	plan := &Plan{}
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), cluster, nil, Options{DryRun: true, Plan: plan})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kubeClientSet.Actions()) != 0 {
+		t.Fatalf("expected no API calls in dry-run mode, got %v", kubeClientSet.Actions())
+	}
+	changes := plan.Changes()
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 planned change, got %d", len(changes))
+	}
+	if changes[0].Action != ActionCreate || changes[0].Kind != "Secret" || changes[0].Name != util.GetManagedClusterKubeconfigSecretName(cluster.Name) {
+		t.Fatalf("unexpected planned change %+v", changes[0])
+	}
+	if strings.Contains(changes[0].Diff, cluster.KubeConfigContents) {
+		t.Fatalf("expected planned diff to be redacted, got %s", changes[0].Diff)
+	}
+}
+
+func TestUpdateSecretDryRun(t *testing.T) {
+	cluster := newTestCluster()
+	existing := newSecret(util.GetManagedClusterKubeconfigSecretName(cluster.Name), cluster)
+	kubeClientSet := fake.NewSimpleClientset(existing)
+	plan := &Plan{}
+
+	cluster.KubeConfigContents = "rotated kubeconfig"
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t, existing), cluster, nil, Options{DryRun: true, Plan: plan})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kubeClientSet.Actions()) != 0 {
+		t.Fatalf("expected no API calls in dry-run mode, got %v", kubeClientSet.Actions())
+	}
+	changes := plan.Changes()
+	if len(changes) != 1 || changes[0].Action != ActionUpdate {
+		t.Fatalf("expected 1 planned update, got %+v", changes)
+	}
+	if !strings.Contains(changes[0].Diff, "redacted sha256") || strings.Contains(changes[0].Diff, "rotated kubeconfig") {
+		t.Fatalf("expected planned diff to contain only checksums, got %s", changes[0].Diff)
+	}
+}
+
+func TestServerDryRunSecret(t *testing.T) {
+	cluster := newTestCluster()
+	kubeClientSet := fake.NewSimpleClientset()
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+	plan := &Plan{}
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), cluster, nil, Options{DryRun: true, ServerDryRun: true, Plan: plan})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Changes()) != 1 {
+		t.Fatalf("expected 1 planned change, got %d", len(plan.Changes()))
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single dry-run apply call, got %v", kubeClientSet.Actions())
+	}
+}
+
+func TestCreateSecret(t *testing.T) {
+	cluster := newTestCluster()
+	kubeClientSet := fake.NewSimpleClientset()
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), cluster, nil, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 || (*patches)[0].GetNamespace() != constants.DefaultNamespace {
+		t.Fatalf("expected a single apply call, got %v", kubeClientSet.Actions())
+	}
+	content := decodePatch(t, (*patches)[0])
+	if content["apiVersion"] != "v1" || content["kind"] != "Secret" {
+		t.Fatalf("expected apply patch to carry apiVersion and kind, got %v", content)
+	}
+	metadata := content["metadata"].(map[string]interface{})
+	if _, ok := metadata["creationTimestamp"]; ok {
+		t.Fatalf("expected apply patch to omit server populated metadata, got %v", metadata)
+	}
+}
+
+func TestCreateSecretOfPausedOwner(t *testing.T) {
+	owner := newVerrazzanoManagedCluster(newTestCluster())
+	owner.Annotations = map[string]string{constants.PausedAnnotation: "true"}
+	kubeClientSet := fake.NewSimpleClientset()
+
+	rotation, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), newTokenCluster("kubeconfig-1", "token-1"), owner, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kubeClientSet.Actions()) != 0 {
+		t.Fatalf("expected the secret of a paused VerrazzanoManagedCluster to be left alone, got %v", kubeClientSet.Actions())
+	}
+	if !reflect.DeepEqual(rotation.RevokeTokens, []string{"token-1"}) {
+		t.Fatalf("expected the unused generated token to be revoked, got %v", rotation.RevokeTokens)
+	}
+}
+
+func TestUpdateSecretWithoutChanges(t *testing.T) {
+	cluster := newTestCluster()
+	existing := newSecret(util.GetManagedClusterKubeconfigSecretName(cluster.Name), cluster)
+	existing.ResourceVersion = "42"
+	existing.Annotations = map[string]string{
+		constants.KubeconfigRotatedAtAnnotation: "2020-12-01T00:00:00Z",
+		constants.KubeconfigChecksumAnnotation:  secretbackend.Checksum([]byte(cluster.KubeConfigContents)),
+		"other-tool":                            "value",
+	}
+	kubeClientSet := fake.NewSimpleClientset(existing)
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t, existing), cluster, nil, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 0 {
+		t.Fatalf("expected no apply call for an unchanged secret, got %v", kubeClientSet.Actions())
+	}
+}
+
+func TestCreateSecretWithOwner(t *testing.T) {
+	cluster := newTestCluster()
+	owner := newVerrazzanoManagedCluster(cluster)
+	owner.UID = "1234"
+	kubeClientSet := fake.NewSimpleClientset()
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), cluster, owner, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single apply call, got %v", kubeClientSet.Actions())
+	}
+	metadata := decodePatch(t, (*patches)[0])["metadata"].(map[string]interface{})
+	ownerRefs, ok := metadata["ownerReferences"].([]interface{})
+	if !ok || len(ownerRefs) != 1 {
+		t.Fatalf("expected a single owner reference, got %v", metadata)
+	}
+	ownerRef := ownerRefs[0].(map[string]interface{})
+	if ownerRef["kind"] != "VerrazzanoManagedCluster" || ownerRef["name"] != owner.Name || ownerRef["uid"] != "1234" {
+		t.Fatalf("unexpected owner reference %v", ownerRef)
+	}
+}
+
+func TestSecretTokenName(t *testing.T) {
+	cluster := newTestCluster()
+	cluster.TokenName = "kubeconfig-user-abcde"
+	secret := newSecret(util.GetManagedClusterKubeconfigSecretName(cluster.Name), cluster)
+	if name := GetSecretTokenName(secret); name != "kubeconfig-user-abcde" {
+		t.Fatalf("expected token name %s, got %s", "kubeconfig-user-abcde", name)
+	}
+	secret.Annotations = nil
+	if name := GetSecretTokenName(secret); name != "" {
+		t.Fatalf("expected no token name for a kubeconfig without a Rancher token, got %s", name)
+	}
+}
+
+func TestCreateSecretMigratesRenamedSecret(t *testing.T) {
+	previousCluster := newTestCluster()
+	previousCluster.Name = "previous-name"
+	previousCluster.KubeConfigContents = testKubeconfig("previous")
+	previousCluster.TokenName = "previous"
+	previous := newSecret(util.GetManagedClusterKubeconfigSecretName(previousCluster.Name), previousCluster)
+	previous.Annotations = map[string]string{constants.KubeconfigRotatedAtAnnotation: time.Now().UTC().Format(time.RFC3339)}
+	kubeClientSet := fake.NewSimpleClientset()
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	// Credentials that aren't due for rotation are carried over to the secret of the new name
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t, previous), newTokenCluster("current", "current"), nil, Options{Rotation: RotationPolicy{MaxAge: time.Hour}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*patches) != 1 || (*patches)[0].GetName() != util.GetManagedClusterKubeconfigSecretName("name") {
+		t.Fatalf("expected the secret of the new name to be applied, got %v", *patches)
+	}
+	data := decodePatch(t, (*patches)[0])["data"].(map[string]interface{})
+	if data[constants.KubeconfigSecretKey] != base64.StdEncoding.EncodeToString([]byte(testKubeconfig("previous"))) {
+		t.Fatalf("expected the previous credentials to be migrated, got %v", data)
+	}
+}
+
+// memoryBackend keeps kubeconfigs in memory, referenced by the secrets like an external store
+type memoryBackend struct {
+	secretbackend.Kubernetes
+	kubeconfigs map[string][]byte
+}
+
+func (m *memoryBackend) Location(secretName string) string {
+	return "memory://" + secretName
+}
+
+func (m *memoryBackend) Encode(secret *corev1.Secret, kubeconfig []byte) {
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[constants.KubeconfigLocationAnnotation] = m.Location(secret.Name)
+	secret.Data = nil
+}
+
+func (m *memoryBackend) Write(secret *corev1.Secret, kubeconfig []byte) error {
+	m.kubeconfigs[secret.Name] = kubeconfig
+	return nil
+}
+
+func (m *memoryBackend) Read(secret *corev1.Secret) ([]byte, error) {
+	return m.kubeconfigs[secret.Name], nil
+}
+
+func (m *memoryBackend) Delete(secret *corev1.Secret) error {
+	delete(m.kubeconfigs, secret.Name)
+	return nil
+}
+
+func TestCreateSecretWithExternalBackend(t *testing.T) {
+	cluster := newTestCluster()
+	secretName := util.GetManagedClusterKubeconfigSecretName(cluster.Name)
+	backend := &memoryBackend{kubeconfigs: map[string][]byte{}}
+	kubeClientSet := fake.NewSimpleClientset()
+	patches := addApplyReactor(&kubeClientSet.Fake, "secrets")
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), cluster, nil, Options{Backend: backend})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(backend.kubeconfigs[secretName]) != cluster.KubeConfigContents {
+		t.Fatalf("expected the kubeconfig to be written to the backend, got %v", backend.kubeconfigs)
+	}
+	if len(*patches) != 1 {
+		t.Fatalf("expected a single apply call, got %v", kubeClientSet.Actions())
+	}
+	content := decodePatch(t, (*patches)[0])
+	if _, ok := content["data"]; ok {
+		t.Fatalf("expected the secret to hold no kubeconfig, got %v", content)
+	}
+	annotations := content["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if annotations[constants.KubeconfigLocationAnnotation] != "memory://"+secretName {
+		t.Fatalf("expected the secret to reference the kubeconfig, got %v", annotations)
+	}
+
+	// Deleting the secret deletes the stored kubeconfig
+	existing := newSecret(secretName, cluster)
+	backend.Encode(existing, []byte(cluster.KubeConfigContents))
+	kubeClientSet = fake.NewSimpleClientset(existing)
+	if err = deleteSecret(kubeClientSet, existing, Options{Backend: backend}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(backend.kubeconfigs) != 0 {
+		t.Fatalf("expected the stored kubeconfig to be deleted, got %v", backend.kubeconfigs)
+	}
+}
+
+func TestDryRunSecretWithExternalBackend(t *testing.T) {
+	cluster := newTestCluster()
+	backend := &memoryBackend{kubeconfigs: map[string][]byte{}}
+	kubeClientSet := fake.NewSimpleClientset()
+
+	_, err := CreateSecret(kubeClientSet, testutil.NewSecretLister(t), cluster, nil, Options{Backend: backend, DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(backend.kubeconfigs) != 0 {
+		t.Fatalf("expected no kubeconfig to be written in dry-run mode, got %v", backend.kubeconfigs)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Maps the names of clusters in their source to the names of the resources generated for them
+
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/util"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// hashSuffixLength is the number of hex digits of the hash appended to names that had to be changed
+const hashSuffixLength = 8
+
+// Conflict is a set of clusters whose names map to the same resource name
+type Conflict struct {
+	// Name is the resource name the clusters map to
+	Name string
+	// Owner is the cluster the resources are generated for
+	Owner source.Cluster
+	// Skipped are the clusters left without resources
+	Skipped []source.Cluster
+}
+
+// ResourceName returns the name of the resources generated for a cluster of the given name.  Names that are valid
+// DNS-1123 labels are used as is, others are lowercased, stripped of invalid characters and truncated, and suffixed
+// with a hash of the original name so that different names stay different.
+func ResourceName(name string) string {
+	if len(validation.IsDNS1123Label(name)) == 0 {
+		return name
+	}
+	return sanitize(name, validation.DNS1123LabelMaxLength)
+}
+
+// sanitize a name to at most maxLength lowercase alphanumerics and dashes, ending with a hash of the original name
+func sanitize(name string, maxLength int) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+		} else if !strings.HasSuffix(builder.String(), "-") {
+			builder.WriteRune('-')
+		}
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(sum[:])[:hashSuffixLength]
+	sanitized := builder.String()
+	if len(sanitized) > maxLength-hashSuffixLength-1 {
+		sanitized = sanitized[:maxLength-hashSuffixLength-1]
+	}
+	sanitized = strings.Trim(sanitized, "-")
+	if sanitized == "" {
+		return "cluster-" + suffix
+	}
+	return sanitized + "-" + suffix
+}
+
+// Failure is a cluster the naming rules could not be applied to
+type Failure struct {
+	Cluster source.Cluster
+	Err     error
+}
+
+// Resolve applies the naming rules to each cluster.  When several clusters map to the same resource name, the
+// resources stay with the cluster that the existing resources belong to according to owners, which maps resource
+// names to cluster ID label values, or else with the cluster of the lowest ID.  The other clusters are left out of the
+// returned clusters and reported as conflicts, as are the clusters the rules fail for.
+func (r *Rules) Resolve(clusters []source.Cluster, owners map[string]string) ([]source.Cluster, []Conflict, []Failure) {
+	byName := map[string][]source.Cluster{}
+	var names []string
+	var failures []Failure
+	for _, cluster := range clusters {
+		named, err := r.Apply(cluster)
+		if err != nil {
+			failures = append(failures, Failure{Cluster: named, Err: err})
+			continue
+		}
+		if _, ok := byName[named.Name]; !ok {
+			names = append(names, named.Name)
+		}
+		byName[named.Name] = append(byName[named.Name], named)
+	}
+
+	var resolved []source.Cluster
+	var conflicts []Conflict
+	for _, name := range names {
+		candidates := byName[name]
+		if len(candidates) == 1 {
+			resolved = append(resolved, candidates[0])
+			continue
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			iOwns := owners[name] == util.GetClusterIDLabelValue(candidates[i].ID)
+			jOwns := owners[name] == util.GetClusterIDLabelValue(candidates[j].ID)
+			if iOwns != jOwns {
+				return iOwns
+			}
+			return candidates[i].ID < candidates[j].ID
+		})
+		resolved = append(resolved, candidates[0])
+		conflicts = append(conflicts, Conflict{Name: name, Owner: candidates[0], Skipped: candidates[1:]})
+	}
+	return resolved, conflicts, failures
+}
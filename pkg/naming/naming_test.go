@@ -0,0 +1,61 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestResourceName(t *testing.T) {
+	if name := ResourceName("cluster-1"); name != "cluster-1" {
+		t.Fatalf("expected a valid name to be used as is, got %s", name)
+	}
+
+	names := map[string]bool{}
+	for _, displayName := range []string{"My Cluster", "my-cluster", "MY_CLUSTER", "--", "", strings.Repeat("Long Name ", 20)} {
+		name := ResourceName(displayName)
+		if errs := validation.IsDNS1123Label(name); len(errs) != 0 {
+			t.Fatalf("expected a valid name for %q, got %s: %v", displayName, name, errs)
+		}
+		if name != ResourceName(displayName) {
+			t.Fatalf("expected a stable name for %q", displayName)
+		}
+		if names[name] {
+			t.Fatalf("expected different names to map to different resource names, got %s twice", name)
+		}
+		names[name] = true
+	}
+	if name := ResourceName("My Cluster"); !strings.HasPrefix(name, "my-cluster-") {
+		t.Fatalf("expected a readable name, got %s", name)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	clusters := []source.Cluster{
+		{ID: "c-2", Name: "prod"},
+		{ID: "c-1", Name: "prod"},
+		{ID: "c-3", Name: "Dev Cluster"},
+	}
+
+	resolved, conflicts, failures := DefaultRules().Resolve(clusters, nil)
+	if len(failures) != 0 {
+		t.Fatalf("unexpected failures %v", failures)
+	}
+	if len(resolved) != 2 || resolved[0].ID != "c-1" || resolved[1].DisplayName != "Dev Cluster" || resolved[1].Name != ResourceName("Dev Cluster") {
+		t.Fatalf("unexpected resolved clusters %v", resolved)
+	}
+	if len(conflicts) != 1 || conflicts[0].Name != "prod" || conflicts[0].Owner.ID != "c-1" || len(conflicts[0].Skipped) != 1 || conflicts[0].Skipped[0].ID != "c-2" {
+		t.Fatalf("unexpected conflicts %v", conflicts)
+	}
+
+	// The cluster of the existing resources keeps them
+	resolved, conflicts, _ = DefaultRules().Resolve(clusters, map[string]string{"prod": "c-2"})
+	if resolved[0].ID != "c-2" || conflicts[0].Skipped[0].ID != "c-1" {
+		t.Fatalf("expected the owner of the existing resources to keep them, got %v", resolved)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Propagation selects the labels and annotations of clusters in their source that are copied onto the generated
+// resources.  Nothing is copied unless selected.
+type Propagation struct {
+	Labels      []PropagationRule `json:"labels,omitempty"`
+	Annotations []PropagationRule `json:"annotations,omitempty"`
+}
+
+// PropagationRule selects the labels or annotations of a cluster with the given key, or with keys starting with the
+// given prefix
+type PropagationRule struct {
+	// Key selects the label or annotation with the given key
+	Key string `json:"key,omitempty"`
+	// Prefix selects the labels or annotations with keys starting with the given prefix
+	Prefix string `json:"prefix,omitempty"`
+	// As is the key of the copy of the selected label or annotation, or the prefix replacing Prefix in the keys of the
+	// copies.  The keys are kept if not set.
+	As string `json:"as,omitempty"`
+}
+
+// validate checks that a rule selects labels or annotations and maps them to valid keys
+func (r PropagationRule) validate() error {
+	if (r.Key == "") == (r.Prefix == "") {
+		return errors.New("propagation rule must have either a key or a prefix")
+	}
+	if r.Key != "" {
+		key := r.Key
+		if r.As != "" {
+			key = r.As
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return fmt.Errorf("invalid propagated key %s: %s", key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// map a key to the key of its copy, returns false if the rule doesn't select the key
+func (r PropagationRule) mapKey(key string) (string, bool) {
+	if r.Key != "" {
+		if key != r.Key {
+			return "", false
+		}
+		if r.As != "" {
+			return r.As, true
+		}
+		return key, true
+	}
+	if !strings.HasPrefix(key, r.Prefix) {
+		return "", false
+	}
+	if r.As != "" {
+		return r.As + strings.TrimPrefix(key, r.Prefix), true
+	}
+	return key, true
+}
+
+// propagate copies the entries selected by the rules, the first rule selecting an entry wins, as does the last entry
+// in key order of those mapped to the same key.  Entries that are not valid as labels, when isLabel is set, or as
+// annotations once mapped are skipped.
+func propagate(rules []PropagationRule, values map[string]string, isLabel bool) map[string]string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var copies map[string]string
+	for _, key := range keys {
+		value := values[key]
+		for _, rule := range rules {
+			mappedKey, ok := rule.mapKey(key)
+			if !ok {
+				continue
+			}
+			errs := validation.IsQualifiedName(mappedKey)
+			if isLabel {
+				errs = append(errs, validation.IsValidLabelValue(value)...)
+			}
+			if len(errs) != 0 {
+				zap.S().Warnf("Skipping propagation of %s=%s, for the reason (%s)", key, value, strings.Join(errs, ", "))
+				break
+			}
+			if copies == nil {
+				copies = map[string]string{}
+			}
+			copies[mappedKey] = value
+			break
+		}
+	}
+	return copies
+}
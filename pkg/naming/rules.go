@@ -0,0 +1,249 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package naming
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the configuration of the naming rules, each value being a Go template executed with TemplateData
+type Config struct {
+	// Name is the template of the name of the VerrazzanoManagedCluster of a cluster
+	Name string `json:"name,omitempty"`
+	// SecretName is the template of the name of the kubeconfig secret of a cluster
+	SecretName string `json:"secretName,omitempty"`
+	// Labels are the templates of the labels added to the generated resources, by label key
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are the templates of the annotations added to the generated resources, by annotation key
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Propagate selects the labels and annotations of clusters copied onto the generated resources, the templated
+	// labels and annotations take precedence over the copies
+	Propagate Propagation `json:"propagate,omitempty"`
+}
+
+// TemplateData is the data the naming templates are executed with
+type TemplateData struct {
+	ID            string
+	Name          string
+	Type          string
+	ServerAddress string
+	Labels        map[string]string
+	// ResourceName is the name of the VerrazzanoManagedCluster, unset when executing the Name template
+	ResourceName string
+}
+
+// DefaultConfig returns the configuration of the default naming rules, naming the resources after the cluster
+func DefaultConfig() Config {
+	return Config{
+		Name:       "{{.Name}}",
+		SecretName: constants.ManagedClusterPrefix + "-{{.ResourceName}}",
+	}
+}
+
+// Rules generate the names, labels and annotations of the resources of a cluster
+type Rules struct {
+	name        *template.Template
+	secretName  *template.Template
+	labels      map[string]*template.Template
+	annotations map[string]*template.Template
+	propagation Propagation
+}
+
+// sample cluster the templates are validated with
+var sampleCluster = source.Cluster{ID: "c-sample", Name: "sample", Type: "rancher", ServerAddress: "sample.example.com:6443"}
+
+// template functions available in addition to the builtin ones
+var templateFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"replace": strings.ReplaceAll,
+	"default": func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// DefaultRules returns the default naming rules
+func DefaultRules() *Rules {
+	rules, err := NewRules(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+// LoadRules reads the naming rules from a YAML or JSON configuration file.  Rules missing from the file default to
+// those of DefaultConfig, and the default rules are returned if path is empty.
+func LoadRules(path string) (*Rules, error) {
+	if path == "" {
+		return DefaultRules(), nil
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err = yaml.UnmarshalStrict(contents, &config); err != nil {
+		return nil, fmt.Errorf("error parsing naming configuration %s: %v", path, err)
+	}
+	return NewRules(config)
+}
+
+// NewRules compiles the templates of a naming configuration, and validates them by executing them for a sample
+// cluster
+func NewRules(config Config) (*Rules, error) {
+	defaults := DefaultConfig()
+	if config.Name == "" {
+		config.Name = defaults.Name
+	}
+	if config.SecretName == "" {
+		config.SecretName = defaults.SecretName
+	}
+
+	var err error
+	rules := &Rules{labels: map[string]*template.Template{}, annotations: map[string]*template.Template{}, propagation: config.Propagate}
+	if rules.name, err = parseTemplate("name", config.Name); err != nil {
+		return nil, err
+	}
+	if rules.secretName, err = parseTemplate("secretName", config.SecretName); err != nil {
+		return nil, err
+	}
+	for key, text := range config.Labels {
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid label key %s: %s", key, strings.Join(errs, ", "))
+		}
+		if rules.labels[key], err = parseTemplate("labels."+key, text); err != nil {
+			return nil, err
+		}
+	}
+	for key, text := range config.Annotations {
+		if errs := validation.IsQualifiedName(key); len(errs) != 0 {
+			return nil, fmt.Errorf("invalid annotation key %s: %s", key, strings.Join(errs, ", "))
+		}
+		if rules.annotations[key], err = parseTemplate("annotations."+key, text); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range append(append([]PropagationRule{}, config.Propagate.Labels...), config.Propagate.Annotations...) {
+		if err = rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err = rules.Apply(sampleCluster); err != nil {
+		return nil, fmt.Errorf("error validating naming rules: %v", err)
+	}
+	return rules, nil
+}
+
+// Apply sets the name, secret name, labels and annotations of the resources of a cluster according to the rules,
+// keeping the name of the cluster in its source as the display name.  The labels and annotations of the cluster are
+// copied according to the propagation rules.  Generated names are sanitized, while an invalid
+// label value is an error.  Labels and annotations rendering as empty strings are left out.
+func (r *Rules) Apply(cluster source.Cluster) (source.Cluster, error) {
+	if cluster.DisplayName == "" {
+		cluster.DisplayName = cluster.Name
+	}
+	data := TemplateData{
+		ID:            cluster.ID,
+		Name:          cluster.DisplayName,
+		Type:          cluster.Type,
+		ServerAddress: cluster.ServerAddress,
+		Labels:        cluster.Labels,
+	}
+	name, err := execute(r.name, data)
+	if err != nil {
+		return cluster, err
+	}
+	cluster.Name = ResourceName(name)
+	data.ResourceName = cluster.Name
+
+	secretName, err := execute(r.secretName, data)
+	if err != nil {
+		return cluster, err
+	}
+	cluster.SecretName = SubdomainName(secretName)
+
+	cluster.ResourceLabels = propagate(r.propagation.Labels, cluster.Labels, true)
+	for _, key := range sortedKeys(r.labels) {
+		value, err := execute(r.labels[key], data)
+		if err != nil {
+			return cluster, err
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) != 0 {
+			return cluster, fmt.Errorf("invalid value %q of label %s: %s", value, key, strings.Join(errs, ", "))
+		}
+		if value == "" {
+			continue
+		}
+		if cluster.ResourceLabels == nil {
+			cluster.ResourceLabels = map[string]string{}
+		}
+		cluster.ResourceLabels[key] = value
+	}
+	cluster.ResourceAnnotations = propagate(r.propagation.Annotations, cluster.Annotations, false)
+	for _, key := range sortedKeys(r.annotations) {
+		value, err := execute(r.annotations[key], data)
+		if err != nil {
+			return cluster, err
+		}
+		if value == "" {
+			continue
+		}
+		if cluster.ResourceAnnotations == nil {
+			cluster.ResourceAnnotations = map[string]string{}
+		}
+		cluster.ResourceAnnotations[key] = value
+	}
+	return cluster, nil
+}
+
+// SubdomainName returns the given name if it is a valid DNS-1123 subdomain, such as the name of a secret, otherwise a
+// sanitized name suffixed with a hash of the given name
+func SubdomainName(name string) string {
+	if len(validation.IsDNS1123Subdomain(name)) == 0 {
+		return name
+	}
+	return sanitize(name, validation.DNS1123SubdomainMaxLength)
+}
+
+// parse a naming template, missing map keys render as empty strings
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing naming template %s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// execute a naming template, trimming surrounding whitespace
+func execute(tmpl *template.Template, data TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// the keys of a template map in a stable order
+func sortedKeys(templates map[string]*template.Template) []string {
+	keys := make([]string, 0, len(templates))
+	for key := range templates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package naming
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
+)
+
+func TestDefaultRules(t *testing.T) {
+	cluster, err := DefaultRules().Apply(source.Cluster{ID: "c-1", Name: "My Cluster"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cluster.DisplayName != "My Cluster" || cluster.Name != ResourceName("My Cluster") {
+		t.Fatalf("unexpected names %s, %s", cluster.DisplayName, cluster.Name)
+	}
+	if cluster.SecretName != "verrazzano-managed-cluster-"+cluster.Name {
+		t.Fatalf("unexpected secret name %s", cluster.SecretName)
+	}
+	if cluster.ResourceLabels != nil || cluster.ResourceAnnotations != nil {
+		t.Fatalf("expected no labels or annotations, got %v, %v", cluster.ResourceLabels, cluster.ResourceAnnotations)
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "naming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "naming.yaml")
+	config := `name: "{{.Type}}-{{.Name}}"
+secretName: "{{.ResourceName}}-kubeconfig"
+labels:
+  region: '{{index .Labels "region"}}'
+  example.com/team: '{{default .Labels.team "none"}}'
+annotations:
+  example.com/server: "{{.ServerAddress}}"
+`
+	if err = ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cluster, err := rules.Apply(source.Cluster{ID: "c-1", Name: "prod", Type: "oke", ServerAddress: "host:6443", Labels: map[string]string{"region": "phx"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cluster.Name != "oke-prod" || cluster.SecretName != "oke-prod-kubeconfig" {
+		t.Fatalf("unexpected names %s, %s", cluster.Name, cluster.SecretName)
+	}
+	if len(cluster.ResourceLabels) != 2 || cluster.ResourceLabels["region"] != "phx" || cluster.ResourceLabels["example.com/team"] != "none" {
+		t.Fatalf("unexpected labels %v", cluster.ResourceLabels)
+	}
+	if cluster.ResourceAnnotations["example.com/server"] != "host:6443" {
+		t.Fatalf("unexpected annotations %v", cluster.ResourceAnnotations)
+	}
+
+	// Labels rendering as empty strings are left out
+	cluster, err = rules.Apply(source.Cluster{ID: "c-2", Name: "dev", Type: "oke", ServerAddress: "host:6443"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := cluster.ResourceLabels["region"]; ok {
+		t.Fatalf("expected no region label, got %v", cluster.ResourceLabels)
+	}
+
+	// Invalid label values fail
+	if _, err = rules.Apply(source.Cluster{ID: "c-3", Name: "dev", Labels: map[string]string{"region": "not a label value"}}); err == nil {
+		t.Fatalf("expected an error for an invalid label value")
+	}
+}
+
+func TestNewRulesInvalid(t *testing.T) {
+	configs := map[string]Config{
+		"syntax":        {Name: "{{.Name"},
+		"unknown field": {Name: "{{.Unknown}}"},
+		"unknown func":  {SecretName: "{{nope .Name}}"},
+		"label key":     {Labels: map[string]string{"not a key": "value"}},
+		"label value":   {Labels: map[string]string{"key": "{{.ServerAddress}}"}},
+	}
+	for name, config := range configs {
+		if _, err := NewRules(config); err == nil {
+			t.Errorf("expected an error for invalid %s", name)
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	rules, err := NewRules(Config{
+		Labels: map[string]string{"env": "{{.Type}}"},
+		Propagate: Propagation{
+			Labels: []PropagationRule{
+				{Key: "env"},
+				{Key: "region", As: "topology.kubernetes.io/region"},
+				{Prefix: "team.example.com/", As: "verrazzano.io/team-"},
+			},
+			Annotations: []PropagationRule{{Prefix: "example.com/"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cluster, err := rules.Apply(source.Cluster{
+		ID:          "c-1",
+		Name:        "prod",
+		Type:        "oke",
+		Labels:      map[string]string{"env": "prod", "region": "phx", "team.example.com/name": "blue", "team.example.com/bad": "not a value", "other": "value"},
+		Annotations: map[string]string{"example.com/notes": "free form text", "other.com/notes": "value"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedLabels := map[string]string{"env": "oke", "topology.kubernetes.io/region": "phx", "verrazzano.io/team-name": "blue"}
+	if !reflect.DeepEqual(cluster.ResourceLabels, expectedLabels) {
+		t.Fatalf("expected labels %v, got %v", expectedLabels, cluster.ResourceLabels)
+	}
+	expectedAnnotations := map[string]string{"example.com/notes": "free form text"}
+	if !reflect.DeepEqual(cluster.ResourceAnnotations, expectedAnnotations) {
+		t.Fatalf("expected annotations %v, got %v", expectedAnnotations, cluster.ResourceAnnotations)
+	}
+}
+
+func TestPropagationInvalid(t *testing.T) {
+	invalid := []PropagationRule{{}, {Key: "a", Prefix: "b"}, {Key: "region", As: "not a key"}}
+	for _, rule := range invalid {
+		if _, err := NewRules(Config{Propagate: Propagation{Labels: []PropagationRule{rule}}}); err == nil {
+			t.Errorf("expected an error for invalid rule %v", rule)
+		}
+	}
+}
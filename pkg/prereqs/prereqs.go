@@ -0,0 +1,226 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles the bundle of prerequisite manifests applied to managed clusters
+
+package prereqs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/serviceaccount"
+	"go.uber.org/zap"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// Kinds applied ahead of the rest of the bundle, since other manifests may depend on them
+var kindOrder = map[string]int{
+	"CustomResourceDefinition": 0,
+	"Namespace":                1,
+	"ServiceAccount":           2,
+	"ClusterRole":              3,
+	"ClusterRoleBinding":       4,
+	"Role":                     5,
+	"RoleBinding":              6,
+}
+
+// Bundle is an ordered set of prerequisite manifests applied to each managed cluster
+type Bundle struct {
+	// Manifests are the objects to apply, in apply order
+	Manifests []*unstructured.Unstructured
+	// Hash identifies the contents of the bundle
+	Hash string
+}
+
+// DefaultBundle returns the built-in bundle, containing the verrazzano-system namespace, service account and RBAC.
+// The verrazzano-system ClusterRole has the given rules.
+func DefaultBundle(rules []rbacv1.PolicyRule) (*Bundle, error) {
+	var manifests []*unstructured.Unstructured
+	for _, obj := range serviceaccount.Objects(rules) {
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		unstructured.RemoveNestedField(content, "metadata", "creationTimestamp")
+		manifests = append(manifests, &unstructured.Unstructured{Object: content})
+	}
+	return newBundle(manifests)
+}
+
+// LoadBundle loads the bundle from the .yaml, .yml and .json files of the given directory, or returns the built-in
+// bundle with the given service account rules if no directory is given.  Files may contain multiple YAML documents.
+func LoadBundle(dir string, rules []rbacv1.PolicyRule) (*Bundle, error) {
+	if dir == "" {
+		return DefaultBundle(rules)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []*unstructured.Unstructured
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+		if file.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		contents, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		fileManifests, err := decodeManifests(contents)
+		if err != nil {
+			return nil, fmt.Errorf("error loading prerequisite manifests from %s: %v", file.Name(), err)
+		}
+		manifests = append(manifests, fileManifests...)
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no prerequisite manifests found in %s", dir)
+	}
+	return newBundle(manifests)
+}
+
+// ParseBundle returns a bundle of the manifests in the given YAML documents
+func ParseBundle(contents []byte) (*Bundle, error) {
+	manifests, err := decodeManifests(contents)
+	if err != nil {
+		return nil, err
+	}
+	return newBundle(manifests)
+}
+
+// Decodes the YAML documents of a manifest file, skipping empty documents
+func decodeManifests(contents []byte) ([]*unstructured.Unstructured, error) {
+	var manifests []*unstructured.Unstructured
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(contents)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var content map[string]interface{}
+		if err = yaml.Unmarshal(doc, &content); err != nil {
+			return nil, err
+		}
+		if len(content) == 0 {
+			continue
+		}
+		manifest := &unstructured.Unstructured{Object: content}
+		if manifest.GetAPIVersion() == "" || manifest.GetKind() == "" || manifest.GetName() == "" {
+			return nil, fmt.Errorf("manifest is missing apiVersion, kind or metadata.name")
+		}
+		manifests = append(manifests, manifest)
+	}
+}
+
+// Orders the manifests for applying, and hashes their contents
+func newBundle(manifests []*unstructured.Unstructured) (*Bundle, error) {
+	sort.SliceStable(manifests, func(i, j int) bool {
+		return kindRank(manifests[i].GetKind()) < kindRank(manifests[j].GetKind())
+	})
+	hash := sha256.New()
+	for _, manifest := range manifests {
+		contents, err := json.Marshal(manifest.Object)
+		if err != nil {
+			return nil, err
+		}
+		hash.Write(contents)
+	}
+	return &Bundle{Manifests: manifests, Hash: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+func kindRank(kind string) int {
+	if rank, ok := kindOrder[kind]; ok {
+		return rank
+	}
+	return len(kindOrder)
+}
+
+// NewClients returns the dynamic client and REST mapper for the cluster accessed through the given kubeconfig
+func NewClients(kubeconfigContents string) (dynamic.Interface, meta.RESTMapper, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigContents))
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dynamicClient, restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient)), nil
+}
+
+// Apply applies the manifests of the bundle with server-side apply.  Manifests of kinds that are not known to the
+// cluster are retried after resetting the mapper, so that custom resources may follow their CRDs in the bundle.
+func Apply(dynamicClient dynamic.Interface, mapper meta.RESTMapper, bundle *Bundle, serverDryRun bool) error {
+	patchOptions := metav1.PatchOptions{FieldManager: constants.FieldManager, Force: boolPtr(true)}
+	if serverDryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+	for _, manifest := range bundle.Manifests {
+		mapping, err := restMapping(mapper, manifest)
+		if err != nil {
+			return err
+		}
+		patch, err := json.Marshal(manifest.Object)
+		if err != nil {
+			return err
+		}
+		var resource dynamic.ResourceInterface = dynamicClient.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			resource = dynamicClient.Resource(mapping.Resource).Namespace(manifest.GetNamespace())
+		}
+		zap.S().Debugf("Applying %s '%s' to managed cluster", manifest.GetKind(), manifest.GetName())
+		_, err = resource.Patch(context.TODO(), manifest.GetName(), types.ApplyPatchType, patch, patchOptions)
+		if err != nil {
+			return fmt.Errorf("error applying %s '%s': %v", manifest.GetKind(), manifest.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// Maps the kind of a manifest to its resource, refreshing the mapper once if the kind is not known yet
+func restMapping(mapper meta.RESTMapper, manifest *unstructured.Unstructured) (*meta.RESTMapping, error) {
+	gvk := manifest.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		if resettable, ok := mapper.(interface{ Reset() }); ok {
+			resettable.Reset()
+			mapping, err = mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		}
+	}
+	return mapping, err
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package prereqs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/serviceaccount"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testManifests = `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: verrazzano-system
+data:
+  key: value
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: verrazzano-system
+---
+`
+
+const testCRD = `{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", "metadata": {"name": "things.verrazzano.io"}}`
+
+func writeBundle(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "prereqs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDefaultBundle(t *testing.T) {
+	rules, err := serviceaccount.LoadRules(filepath.Join("..", "..", "deploy", "role.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bundle, err := LoadBundle("", rules)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bundle.Manifests) != len(serviceaccount.Objects(rules)) {
+		t.Fatalf("expected %d manifests, got %d", len(serviceaccount.Objects(rules)), len(bundle.Manifests))
+	}
+	if bundle.Manifests[0].GetKind() != "Namespace" || bundle.Manifests[0].GetName() != serviceaccount.Namespace {
+		t.Fatalf("expected the namespace to be applied first, got %s '%s'", bundle.Manifests[0].GetKind(), bundle.Manifests[0].GetName())
+	}
+	again, _ := DefaultBundle(rules)
+	if again.Hash != bundle.Hash {
+		t.Fatalf("expected a stable hash, got %s and %s", bundle.Hash, again.Hash)
+	}
+}
+
+func TestLoadBundle(t *testing.T) {
+	dir := writeBundle(t, map[string]string{"a.yaml": testManifests, "b.json": testCRD, "README.md": "not a manifest"})
+	defer os.RemoveAll(dir)
+
+	bundle, err := LoadBundle(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var kinds []string
+	for _, manifest := range bundle.Manifests {
+		kinds = append(kinds, manifest.GetKind())
+	}
+	expected := []string{"CustomResourceDefinition", "Namespace", "ConfigMap"}
+	if len(kinds) != len(expected) {
+		t.Fatalf("expected kinds %v, got %v", expected, kinds)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Fatalf("expected kinds %v, got %v", expected, kinds)
+		}
+	}
+
+	// The hash changes with the contents of the bundle
+	changed := writeBundle(t, map[string]string{"a.yaml": testManifests, "b.json": `{"apiVersion": "apiextensions.k8s.io/v1", "kind": "CustomResourceDefinition", "metadata": {"name": "others.verrazzano.io"}}`})
+	defer os.RemoveAll(changed)
+	changedBundle, err := LoadBundle(changed, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if changedBundle.Hash == bundle.Hash {
+		t.Fatalf("expected the hash to change with the bundle contents")
+	}
+}
+
+func TestLoadBundleErrors(t *testing.T) {
+	empty := writeBundle(t, map[string]string{"README.md": "not a manifest"})
+	defer os.RemoveAll(empty)
+	if _, err := LoadBundle(empty, nil); err == nil {
+		t.Fatalf("expected an error for a bundle without manifests")
+	}
+
+	invalid := writeBundle(t, map[string]string{"a.yaml": "kind: Namespace\nmetadata:\n  name: no-version\n"})
+	defer os.RemoveAll(invalid)
+	if _, err := LoadBundle(invalid, nil); err == nil {
+		t.Fatalf("expected an error for a manifest without apiVersion")
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir := writeBundle(t, map[string]string{"a.yaml": testManifests})
+	defer os.RemoveAll(dir)
+	bundle, err := LoadBundle(dir, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+
+	// The fake dynamic client does not support apply patches, record them instead
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	var applied []string
+	client.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		applied = append(applied, patchAction.GetResource().Resource+"/"+patchAction.GetNamespace()+"/"+patchAction.GetName())
+		return true, nil, nil
+	})
+
+	if err = Apply(client, mapper, bundle, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"namespaces//verrazzano-system", "configmaps/verrazzano-system/settings"}
+	if len(applied) != len(expected) || applied[0] != expected[0] || applied[1] != expected[1] {
+		t.Fatalf("expected %v to be applied, got %v", expected, applied)
+	}
+
+	// Kinds unknown to the cluster fail the apply
+	if err = Apply(client, meta.NewDefaultRESTMapper(nil), bundle, false); err == nil {
+		t.Fatalf("expected an error for kinds unknown to the cluster")
+	}
+}
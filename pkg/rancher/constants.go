@@ -15,21 +15,14 @@ type Config struct {
 	CertificateAuthorityData []byte
 }
 
-// Cluster contains Rancher Managed cluster structure
-type Cluster struct {
-	ID                 string
-	Name               string
-	KubeConfigContents string
-	PrometheusURL      string
-	ServerAddress      string
-	Type               string
-}
-
 // Rancher API URLs
 const (
 	clusterReplacementString  = "##CLUSTER_ID##"
+	tokenReplacementString    = "##TOKEN_NAME##"
 	clustersAPIPath           = "/v3/clusters"
 	generateKubeConfigAPIPath = "/v3/clusters/" + clusterReplacementString
+	tokenAPIPath              = "/v3/tokens/" + tokenReplacementString
+	registrationTokensAPIPath = "/v3/clusterregistrationtokens"
 )
 
 // Rancher API configurations
@@ -41,15 +34,22 @@ var (
 
 // Rancher Response json paths
 const (
-	jsonDataPath       = "data"
-	jsonIDPath         = "id"
-	jsonNamePath       = "name"
-	jsonK8sAPIHostPath = "labels.k8sApiHost"
-	jsonK8sAPIPortPath = "labels.k8sApiPort"
-	jsonTypePath       = "labels.type"
-	config             = "config"
+	jsonDataPath        = "data"
+	jsonIDPath          = "id"
+	jsonNamePath        = "name"
+	jsonK8sAPIHostPath  = "labels.k8sApiHost"
+	jsonK8sAPIPortPath  = "labels.k8sApiPort"
+	jsonTypePath        = "labels.type"
+	jsonLabelsPath      = "labels"
+	jsonAnnotationsPath = "annotations"
+	jsonManifestURL     = "manifestUrl"
+	config              = "config"
 )
 
+// OwnerAnnotation is the annotation on the clusters imported into Rancher by the operator, recording the UID of the
+// VerrazzanoManagedCluster the cluster was imported for
+const OwnerAnnotation = "verrazzano.io/verrazzano-managed-cluster-uid"
+
 // RancherNamespace contains constant for Rancher namespace
 const RancherNamespace = "cattle-system"
 
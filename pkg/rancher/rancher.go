@@ -17,26 +17,61 @@ import (
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/Jeffail/gabs/v2"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
 	"go.uber.org/zap"
 )
 
 // interface to expose Rancher APIs
 type rancher interface {
 	APICall(rancherConfig Config, apiPath string, httpMethod string, parameterMap map[string]string, payload string) (*gabs.Container, error)
+	Download(rancherConfig Config, apiPath string) (string, error)
+	Delete(rancherConfig Config, apiPath string) error
 }
 
 // The Rancher default implementation
 type Rancher struct{}
 
+// Source is the cluster source of the clusters managed by a Rancher Server
+type Source struct {
+	rancher rancher
+	config  *Config
+	// SkipKubeconfig, if set, is called before generating the kubeconfig of a cluster.  Clusters it returns true for
+	// are returned without a kubeconfig, so that no Rancher token is minted for clusters whose stored credentials
+	// don't depend on it.
+	SkipKubeconfig func(cluster source.Cluster) bool
+}
+
+// NewSource returns a cluster source for the Rancher Server of the given config.  The config is read on every call,
+// so that updates such as a reloaded CA certificate take effect.
+func NewSource(r rancher, rancherConfig *Config) *Source {
+	return &Source{rancher: r, config: rancherConfig}
+}
+
+// Name identifies the source
+func (s *Source) Name() string {
+	return "rancher"
+}
+
+// GetClusters returns the clusters managed by the Rancher Server
+func (s *Source) GetClusters() ([]source.Cluster, error) {
+	return getClusters(s.rancher, *s.config, s.SkipKubeconfig)
+}
+
 func getRealPath(path string, clusterID string) string {
 	return strings.Replace(path, clusterReplacementString, clusterID, -1)
 }
 
-// GetClusters returns Rancher clusters
-func GetClusters(r rancher, rancherConfig Config) ([]Cluster, error) {
-	var clusters []Cluster
+// GetClusters returns Rancher clusters.  A cluster whose kubeconfig fails to generate is returned with the error, so
+// that it doesn't hold up the other clusters.
+func GetClusters(r rancher, rancherConfig Config) ([]source.Cluster, error) {
+	return getClusters(r, rancherConfig, nil)
+}
+
+func getClusters(r rancher, rancherConfig Config, skipKubeconfig func(cluster source.Cluster) bool) ([]source.Cluster, error) {
+	var clusters []source.Cluster
 
 	json, err := r.APICall(rancherConfig, clustersAPIPath, http.MethodGet, defaultParameterMap, defaultPayload)
 	if err != nil {
@@ -47,23 +82,29 @@ func GetClusters(r rancher, rancherConfig Config) ([]Cluster, error) {
 	for _, clusterInfo := range clustersMap {
 		clusterID := clusterInfo.Path(jsonIDPath).Data().(string)
 
-		// generate kubeconfig contents
-		kubeconfigContents, err := getGenerateKubeconfig(r, rancherConfig, clusterID)
-		if err != nil {
-			return nil, err
-		}
-
 		// get the k8s api server for this cluster
 		server := getValue(clusterInfo, jsonK8sAPIHostPath, "") + ":" + getValue(clusterInfo, jsonK8sAPIPortPath, "")
 
-		clusters = append(
-			clusters, Cluster{
-				ID:                 clusterID,
-				Name:               clusterInfo.Path(jsonNamePath).Data().(string),
-				KubeConfigContents: kubeconfigContents,
-				ServerAddress:      server,
-				Type:               getValue(clusterInfo, jsonTypePath, ""),
-			})
+		cluster := source.Cluster{
+			ID:            clusterID,
+			Name:          clusterInfo.Path(jsonNamePath).Data().(string),
+			ServerAddress: server,
+			Type:          getValue(clusterInfo, jsonTypePath, ""),
+			Labels:        getStringMap(clusterInfo, jsonLabelsPath),
+			Annotations:   getStringMap(clusterInfo, jsonAnnotationsPath),
+		}
+
+		// generate kubeconfig contents
+		if skipKubeconfig == nil || !skipKubeconfig(cluster) {
+			kubeconfigContents, err := getGenerateKubeconfig(r, rancherConfig, clusterID)
+			if err != nil {
+				err = fmt.Errorf("failed to generate the kubeconfig of Rancher cluster %s: %v", clusterID, err)
+			}
+			cluster.KubeConfigContents = kubeconfigContents
+			cluster.TokenName = GetKubeconfigTokenName(kubeconfigContents)
+			cluster.Err = err
+		}
+		clusters = append(clusters, cluster)
 	}
 
 	return clusters, nil
@@ -78,6 +119,17 @@ func getValue(info *gabs.Container, path string, def string) string {
 	return def
 }
 
+// get the string valued entries of the map at the given path, such as the labels of a Rancher cluster
+func getStringMap(info *gabs.Container, path string) map[string]string {
+	values := map[string]string{}
+	for key, value := range info.Path(path).ChildrenMap() {
+		if str, ok := value.Data().(string); ok {
+			values[key] = str
+		}
+	}
+	return values
+}
+
 func getGenerateKubeconfig(r rancher, rancherConfig Config, clusterID string) (string, error) {
 	json, err := r.APICall(rancherConfig, getRealPath(generateKubeConfigAPIPath, clusterID), http.MethodPost, generateKubeConfigParameterMap, "")
 	if err != nil {
@@ -86,6 +138,34 @@ func getGenerateKubeconfig(r rancher, rancherConfig Config, clusterID string) (s
 	return json.Path(config).Data().(string), nil
 }
 
+// GetKubeconfigTokenName returns the name of the Rancher token used by the current context of the given kubeconfig,
+// or an empty string if the kubeconfig doesn't contain a Rancher token.  Rancher tokens are of the form <name>:<secret>.
+func GetKubeconfigTokenName(kubeconfigContents string) string {
+	kubeconfig, err := clientcmd.Load([]byte(kubeconfigContents))
+	if err != nil {
+		zap.S().Debugf("Unable to parse kubeconfig for a Rancher token: %v", err)
+		return ""
+	}
+	context, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return ""
+	}
+	authInfo, ok := kubeconfig.AuthInfos[context.AuthInfo]
+	if !ok {
+		return ""
+	}
+	parts := strings.SplitN(authInfo.Token, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return ""
+	}
+	return parts[0]
+}
+
+// DeleteToken revokes the Rancher token with the given name
+func DeleteToken(r rancher, rancherConfig Config, tokenName string) error {
+	return r.Delete(rancherConfig, strings.Replace(tokenAPIPath, tokenReplacementString, tokenName, -1))
+}
+
 // APICall for Generic Rancher API call returning a json object.
 func (c Rancher) APICall(rancherConfig Config, apiPath string, httpMethod string, parameterMap map[string]string, payload string) (*gabs.Container, error) {
 	defaultHeaders := map[string]string{"Content-Type": "application/json"}
@@ -95,8 +175,8 @@ func (c Rancher) APICall(rancherConfig Config, apiPath string, httpMethod string
 	if err != nil {
 		return nil, err
 	}
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("expected response code %d from POST but got %d: %v", http.StatusOK, response.StatusCode, response)
+	if !isSuccess(response.StatusCode) {
+		return nil, fmt.Errorf("expected a 2xx response code from %s but got %d: %v", httpMethod, response.StatusCode, response)
 	}
 
 	json, err := gabs.ParseJSON([]byte(responseBody))
@@ -107,6 +187,53 @@ func (c Rancher) APICall(rancherConfig Config, apiPath string, httpMethod string
 	return json, nil
 }
 
+// Download for a Generic Rancher GET call returning the raw response body, such as a YAML manifest.
+func (c Rancher) Download(rancherConfig Config, apiPath string) (string, error) {
+	zap.S().Debugf("[Download] url:'%s'", rancherConfig.URL+apiPath)
+
+	response, responseBody, err := WaitForSendRequest(http.MethodGet, rancherConfig, apiPath, map[string]string{}, defaultParameterMap, defaultPayload, DefaultRetry)
+	if err != nil {
+		return "", err
+	}
+	if !isSuccess(response.StatusCode) {
+		return "", fmt.Errorf("expected a 2xx response code from GET but got %d: %v", response.StatusCode, response)
+	}
+	return responseBody, nil
+}
+
+// Delete for a Generic Rancher DELETE call.  A resource that doesn't exist (anymore) counts as deleted, and only
+// server errors are retried, within the short DeleteWait budget.
+func (c Rancher) Delete(rancherConfig Config, apiPath string) error {
+	zap.S().Debugf("[Delete] url:'%s'", rancherConfig.URL+apiPath)
+
+	var lastErr error
+	err := wait.ExponentialBackoff(DeleteWait, func() (bool, error) {
+		response, _, err := SendRequest(http.MethodDelete, rancherConfig, apiPath, map[string]string{}, defaultParameterMap, defaultPayload)
+		if err != nil {
+			lastErr = err
+			return false, nil
+		}
+		if isSuccess(response.StatusCode) || response.StatusCode == http.StatusNotFound {
+			return true, nil
+		}
+		lastErr = fmt.Errorf("expected a 2xx or 404 response code from DELETE but got %d: %v", response.StatusCode, response)
+		// Client errors, such as missing permissions, won't go away by retrying
+		if response.StatusCode < http.StatusInternalServerError {
+			return false, lastErr
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout && lastErr != nil {
+		err = lastErr
+	}
+	return err
+}
+
+// Rancher answers successful requests with 200 OK, or 201 Created when creating resources
+func isSuccess(statusCode int) bool {
+	return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+}
+
 // DefaultRetry is the default backoff for e2e tests.
 var DefaultRetry = wait.Backoff{
 	Steps:    12,
@@ -115,6 +242,13 @@ var DefaultRetry = wait.Backoff{
 	Jitter:   0.1,
 }
 
+// DeleteWait is how long to retry a Rancher DELETE call that fails with a server or connection error
+var DeleteWait = wait.Backoff{
+	Steps:    3,
+	Duration: time.Second,
+	Factor:   2.0,
+}
+
 // Retry executes the provided function repeatedly, retrying until the function
 // returns done = true, errors, or exceeds the given timeout.
 func Retry(backoff wait.Backoff, fn wait.ConditionFunc) error {
@@ -255,8 +389,7 @@ func SendRequest(action string, rancherConfig Config, apiPath string, headers, p
 
 // WaitForSendRequest waits for the given request to return results
 func WaitForSendRequest(action string, rancherConfig Config, apiPath string, headers, parameterMap map[string]string, payload string, backoff wait.Backoff) (latestResponse *http.Response, latestResponseBody string, err error) {
-	expectedStatusCode := http.StatusOK
-	zap.S().Debugf("Waiting for %s to reach status code %d...\n", rancherConfig.URL, expectedStatusCode)
+	zap.S().Debugf("Waiting for %s to reach a 2xx status code...\n", rancherConfig.URL)
 	startTime := time.Now()
 
 	err = Retry(backoff, func() (bool, error) {
@@ -266,7 +399,7 @@ func WaitForSendRequest(action string, rancherConfig Config, apiPath string, hea
 		if reqErr != nil {
 			return false, reqErr
 		}
-		if response.StatusCode == expectedStatusCode {
+		if isSuccess(response.StatusCode) {
 			return true, nil
 		}
 		return false, nil
@@ -8,11 +8,14 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Jeffail/gabs/v2"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/source"
 )
 
 // mock rancher implementation
@@ -23,8 +26,25 @@ func (c TestRancher) APICall(rancherConfig Config, apiPath string, httpMethod st
 		return nil, fmt.Errorf("got %s", rancherConfig.URL)
 	}
 	var responseBody string
-	if apiPath == "/v3/clusters" {
-		responseBody = "{ \"data\": [{\"id\": \"c-ndvgb\", \"name\": \"foo-managed-1\", \"labels\": {\"type\": \"oke\", \"k8sApiHost\": \"130.35.130.66\", \"k8sApiPort\": \"6443\"}},{\"id\": \"c-r998z\", \"name\": \"foo-managed-2\", \"labels\": {\"type\": \"oke\", \"k8sApiHost\": \"147.154.97.197\", \"k8sApiPort\": \"6443\"}},{\"id\": \"local\", \"name\": \"local\", \"labels\": {\"type\": \"oke\", \"k8sApiHost\": \"147.154.96.26\", \"k8sApiPort\": \"6443\"}}]}"
+	if apiPath == "/v3/clusters" && httpMethod == http.MethodPost {
+		if strings.Contains(payload, "\"name\":\"failing\"") {
+			return nil, fmt.Errorf("failed to create cluster")
+		}
+		responseBody = "{\"id\": \"c-imported\", \"name\": \"imported\"}"
+	} else if apiPath == "/v3/clusters" && parameterMap["name"] != "" {
+		responseBody = "{ \"data\": []}"
+		if parameterMap["name"] == "foo-managed-1" {
+			responseBody = "{ \"data\": [{\"id\": \"c-ndvgb\", \"name\": \"foo-managed-1\"}]}"
+		}
+		if parameterMap["name"] == "imported-before" {
+			responseBody = "{ \"data\": [{\"id\": \"c-before\", \"name\": \"imported-before\", \"annotations\": {\"" + OwnerAnnotation + "\": \"uid-1\"}}]}"
+		}
+	} else if apiPath == "/v3/clusterregistrationtokens" && httpMethod == http.MethodPost {
+		responseBody = "{\"id\": \"c-imported:default-token\"}"
+	} else if apiPath == "/v3/clusterregistrationtokens" {
+		responseBody = fmt.Sprintf("{ \"data\": [{\"clusterId\": \"%s\", \"manifestUrl\": \"https://rancher.foo.verrazzano.example.com/v3/import/abc_%s.yaml\"}]}", parameterMap["clusterId"], parameterMap["clusterId"])
+	} else if apiPath == "/v3/clusters" {
+		responseBody = "{ \"data\": [{\"id\": \"c-ndvgb\", \"name\": \"foo-managed-1\", \"labels\": {\"type\": \"oke\", \"k8sApiHost\": \"130.35.130.66\", \"k8sApiPort\": \"6443\"}, \"annotations\": {\"example.com/team\": \"blue\"}},{\"id\": \"c-r998z\", \"name\": \"foo-managed-2\", \"labels\": {\"type\": \"oke\", \"k8sApiHost\": \"147.154.97.197\", \"k8sApiPort\": \"6443\"}},{\"id\": \"local\", \"name\": \"local\", \"labels\": {\"type\": \"oke\", \"k8sApiHost\": \"147.154.96.26\", \"k8sApiPort\": \"6443\"}}]}"
 	} else if httpMethod == http.MethodPost && parameterMap["action"] == "generateKubeconfig" {
 		ss := strings.Split(apiPath, "/")
 		clusterID := ss[len(ss)-1]
@@ -39,6 +59,23 @@ func (c TestRancher) APICall(rancherConfig Config, apiPath string, httpMethod st
 	return json, nil
 }
 
+func (c TestRancher) Download(rancherConfig Config, apiPath string) (string, error) {
+	if !strings.HasPrefix(apiPath, "/v3/import/") {
+		return "", fmt.Errorf("unrecognized download: %s", apiPath)
+	}
+	return "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: cattle-system\n", nil
+}
+
+func (c TestRancher) Delete(rancherConfig Config, apiPath string) error {
+	if !strings.HasPrefix(apiPath, "/v3/tokens/") {
+		return fmt.Errorf("unrecognized delete: %s", apiPath)
+	}
+	if strings.HasSuffix(apiPath, "/failing") {
+		return fmt.Errorf("failed to delete %s", apiPath)
+	}
+	return nil
+}
+
 func TestGetClusters(t *testing.T) {
 	password := generateRandomString()
 	type args struct {
@@ -48,7 +85,7 @@ func TestGetClusters(t *testing.T) {
 	tests := []struct {
 		name    string
 		args    args
-		want    []Cluster
+		want    []source.Cluster
 		wantErr bool
 	}{
 		// test 1 - get 3 clusters
@@ -68,7 +105,7 @@ func TestGetClusters(t *testing.T) {
 					CertificateAuthorityData: []byte{},
 				},
 			},
-			want: []Cluster{
+			want: []source.Cluster{
 				{
 					ID:                 "c-ndvgb",
 					Name:               "foo-managed-1",
@@ -76,6 +113,8 @@ func TestGetClusters(t *testing.T) {
 					PrometheusURL:      "",
 					ServerAddress:      "130.35.130.66:6443",
 					Type:               "oke",
+					Labels:             map[string]string{"type": "oke", "k8sApiHost": "130.35.130.66", "k8sApiPort": "6443"},
+					Annotations:        map[string]string{"example.com/team": "blue"},
 				}, {
 					ID:                 "c-r998z",
 					Name:               "foo-managed-2",
@@ -83,6 +122,8 @@ func TestGetClusters(t *testing.T) {
 					PrometheusURL:      "",
 					ServerAddress:      "147.154.97.197:6443",
 					Type:               "oke",
+					Labels:             map[string]string{"type": "oke", "k8sApiHost": "147.154.97.197", "k8sApiPort": "6443"},
+					Annotations:        map[string]string{},
 				}, {
 					ID:                 "local",
 					Name:               "local",
@@ -90,6 +131,8 @@ func TestGetClusters(t *testing.T) {
 					PrometheusURL:      "",
 					ServerAddress:      "147.154.96.26:6443",
 					Type:               "oke",
+					Labels:             map[string]string{"type": "oke", "k8sApiHost": "147.154.96.26", "k8sApiPort": "6443"},
+					Annotations:        map[string]string{},
 				},
 			},
 			wantErr: false,
@@ -129,6 +172,217 @@ func TestGetClusters(t *testing.T) {
 	}
 }
 
+// mock rancher failing to generate the kubeconfig of one cluster
+type failingKubeconfigRancher struct {
+	TestRancher
+}
+
+func (c failingKubeconfigRancher) APICall(rancherConfig Config, apiPath string, httpMethod string, parameterMap map[string]string, payload string) (*gabs.Container, error) {
+	if parameterMap["action"] == "generateKubeconfig" && strings.HasSuffix(apiPath, "/c-r998z") {
+		return nil, fmt.Errorf("cluster c-r998z is unavailable")
+	}
+	return c.TestRancher.APICall(rancherConfig, apiPath, httpMethod, parameterMap, payload)
+}
+
+func TestGetClustersIsolatesKubeconfigFailures(t *testing.T) {
+	clusters, err := GetClusters(failingKubeconfigRancher{}, Config{URL: "https://rancher.foo.verrazzano.example.com/"})
+	if err != nil {
+		t.Fatalf("GetClusters() unexpected error = %v", err)
+	}
+	if len(clusters) != 3 {
+		t.Fatalf("GetClusters() got %d clusters, want 3", len(clusters))
+	}
+	for _, cluster := range clusters {
+		if cluster.ID == "c-r998z" && (cluster.Err == nil || cluster.KubeConfigContents != "") {
+			t.Errorf("GetClusters() expected the kubeconfig error of %s, got %v", cluster.ID, cluster)
+		}
+		if cluster.ID != "c-r998z" && (cluster.Err != nil || cluster.KubeConfigContents != "generatedKubeConfigOutput:"+cluster.ID) {
+			t.Errorf("GetClusters() expected the kubeconfig of %s, got %v", cluster.ID, cluster)
+		}
+	}
+}
+
+func TestSourceSkipKubeconfig(t *testing.T) {
+	rancherSource := NewSource(failingKubeconfigRancher{}, &Config{URL: "https://rancher.foo.verrazzano.example.com/"})
+	rancherSource.SkipKubeconfig = func(cluster source.Cluster) bool {
+		return cluster.ID == "c-r998z" && cluster.ServerAddress == "147.154.97.197:6443"
+	}
+	clusters, err := rancherSource.GetClusters()
+	if err != nil {
+		t.Fatalf("GetClusters() unexpected error = %v", err)
+	}
+	for _, cluster := range clusters {
+		if cluster.ID == "c-r998z" && (cluster.Err != nil || cluster.KubeConfigContents != "" || cluster.TokenName != "") {
+			t.Errorf("GetClusters() expected no kubeconfig to be generated for %s, got %v", cluster.ID, cluster)
+		}
+		if cluster.ID != "c-r998z" && cluster.KubeConfigContents != "generatedKubeConfigOutput:"+cluster.ID {
+			t.Errorf("GetClusters() expected the kubeconfig of %s, got %v", cluster.ID, cluster)
+		}
+	}
+}
+
+func TestSource(t *testing.T) {
+	rancherConfig := Config{URL: "bad-url"}
+	var clusterSource source.ClusterSource = NewSource(TestRancher{}, &rancherConfig)
+	if clusterSource.Name() != "rancher" {
+		t.Fatalf("expected source name rancher, got %s", clusterSource.Name())
+	}
+	if _, err := clusterSource.GetClusters(); err == nil {
+		t.Fatalf("expected an error for a bad URL")
+	}
+
+	// Updates of the config are picked up by the source
+	rancherConfig.URL = "https://rancher.foo.verrazzano.example.com/"
+	clusters, err := clusterSource.GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 3 {
+		t.Fatalf("expected 3 clusters, got %d", len(clusters))
+	}
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: "c-ndvgb"
+  cluster:
+    server: "https://rancher.foo.verrazzano.example.com/k8s/clusters/c-ndvgb"
+users:
+- name: "c-ndvgb"
+  user:
+    token: "kubeconfig-user-abcde.c-ndvgb:secretvalue"
+contexts:
+- name: "c-ndvgb"
+  context:
+    user: "c-ndvgb"
+    cluster: "c-ndvgb"
+current-context: "c-ndvgb"
+`
+
+func TestGetKubeconfigTokenName(t *testing.T) {
+	if name := GetKubeconfigTokenName(testKubeconfig); name != "kubeconfig-user-abcde.c-ndvgb" {
+		t.Errorf("GetKubeconfigTokenName() got = %s, want %s", name, "kubeconfig-user-abcde.c-ndvgb")
+	}
+	if name := GetKubeconfigTokenName(strings.Replace(testKubeconfig, "kubeconfig-user-abcde.c-ndvgb:", "", 1)); name != "" {
+		t.Errorf("GetKubeconfigTokenName() got = %s for a token without a name, want empty", name)
+	}
+	if name := GetKubeconfigTokenName("not a kubeconfig"); name != "" {
+		t.Errorf("GetKubeconfigTokenName() got = %s for an invalid kubeconfig, want empty", name)
+	}
+}
+
+func TestDeleteToken(t *testing.T) {
+	rancherConfig := Config{URL: "https://rancher.foo.verrazzano.example.com/"}
+	if err := DeleteToken(TestRancher{}, rancherConfig, "kubeconfig-user-abcde.c-ndvgb"); err != nil {
+		t.Errorf("DeleteToken() unexpected error = %v", err)
+	}
+	if err := DeleteToken(TestRancher{}, rancherConfig, "failing"); err == nil {
+		t.Errorf("DeleteToken() expected an error for a failing deletion")
+	}
+}
+
+func TestRancherDelete(t *testing.T) {
+	defaultWait := DeleteWait
+	DeleteWait.Duration = time.Millisecond
+	defer func() { DeleteWait = defaultWait }()
+
+	tests := []struct {
+		name      string
+		status    int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "deleted", status: http.StatusOK, wantCalls: 1},
+		{name: "already gone", status: http.StatusNotFound, wantCalls: 1},
+		{name: "forbidden", status: http.StatusForbidden, wantCalls: 1, wantErr: true},
+		{name: "server error", status: http.StatusInternalServerError, wantCalls: DeleteWait.Steps, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				calls++
+				if req.Method != http.MethodDelete || req.URL.Path != "/v3/tokens/token-1" {
+					t.Errorf("unexpected request %s %s", req.Method, req.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := DeleteToken(Rancher{}, Config{URL: server.URL}, "token-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("DeleteToken() sent %d requests, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestImportCluster(t *testing.T) {
+	rancherConfig := Config{URL: "https://rancher.foo.verrazzano.example.com/"}
+	clusterID, err := ImportCluster(TestRancher{}, rancherConfig, "imported", "uid-1")
+	if err != nil || clusterID != "c-imported" {
+		t.Errorf("ImportCluster() got = %s, error = %v, want c-imported", clusterID, err)
+	}
+
+	// An existing cluster imported for the same owner is reused
+	clusterID, err = ImportCluster(TestRancher{}, rancherConfig, "imported-before", "uid-1")
+	if err != nil || clusterID != "c-before" {
+		t.Errorf("ImportCluster() got = %s, error = %v, want c-before", clusterID, err)
+	}
+
+	// An existing cluster of the same name that wasn't imported for the owner is left alone
+	if _, err = ImportCluster(TestRancher{}, rancherConfig, "imported-before", "uid-2"); err == nil {
+		t.Errorf("ImportCluster() expected an error for a cluster imported for another owner")
+	}
+	if _, err = ImportCluster(TestRancher{}, rancherConfig, "foo-managed-1", "uid-1"); err == nil {
+		t.Errorf("ImportCluster() expected an error for a cluster not imported by the operator")
+	}
+
+	if _, err = ImportCluster(TestRancher{}, rancherConfig, "failing", "uid-1"); err == nil {
+		t.Errorf("ImportCluster() expected an error for a failed import")
+	}
+}
+
+// mock rancher whose clusters have no registration token until one is created
+type tokenlessRancher struct {
+	TestRancher
+	created *int
+}
+
+func (c tokenlessRancher) APICall(rancherConfig Config, apiPath string, httpMethod string, parameterMap map[string]string, payload string) (*gabs.Container, error) {
+	if apiPath == registrationTokensAPIPath && httpMethod == http.MethodPost {
+		*c.created++
+	}
+	if apiPath == registrationTokensAPIPath && httpMethod == http.MethodGet && *c.created == 0 {
+		return gabs.ParseJSON([]byte("{ \"data\": []}"))
+	}
+	return c.TestRancher.APICall(rancherConfig, apiPath, httpMethod, parameterMap, payload)
+}
+
+func TestGetRegistrationManifest(t *testing.T) {
+	rancherConfig := Config{URL: "https://rancher.foo.verrazzano.example.com/"}
+	manifest, err := GetRegistrationManifest(TestRancher{}, rancherConfig, "c-imported")
+	if err != nil {
+		t.Fatalf("GetRegistrationManifest() unexpected error = %v", err)
+	}
+	if !strings.Contains(manifest, "cattle-system") {
+		t.Errorf("GetRegistrationManifest() got = %s, want the agent manifest", manifest)
+	}
+
+	// A token is only created for a cluster without one
+	created := 0
+	if _, err = GetRegistrationManifest(tokenlessRancher{created: &created}, rancherConfig, "c-imported"); err != nil || created != 1 {
+		t.Fatalf("GetRegistrationManifest() expected a token to be created, got %d and error %v", created, err)
+	}
+	if _, err = GetRegistrationManifest(tokenlessRancher{created: &created}, rancherConfig, "c-imported"); err != nil || created != 1 {
+		t.Fatalf("GetRegistrationManifest() expected the existing token to be reused, got %d and error %v", created, err)
+	}
+}
+
 // generateRandomString returns a base64 encoded generated random string.
 func generateRandomString() string {
 	b := make([]byte, 32)
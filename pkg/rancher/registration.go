@@ -0,0 +1,118 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package rancher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RegistrationWait is how long to wait for Rancher to generate the agent manifest of an imported cluster
+var RegistrationWait = wait.Backoff{
+	Steps:    10,
+	Duration: time.Second,
+	Factor:   1.5,
+}
+
+// ImportCluster creates an imported cluster with the given name in Rancher, annotated with the UID of the owning
+// VerrazzanoManagedCluster, and returns its ID.  An existing cluster of that name is only reused if it was imported
+// for the same owner, such as by an earlier attempt that failed later on, otherwise an error is returned.
+func ImportCluster(r rancher, rancherConfig Config, name string, ownerUID string) (string, error) {
+	if ownerUID == "" {
+		return "", fmt.Errorf("cluster '%s' has no owner UID", name)
+	}
+	existing, err := r.APICall(rancherConfig, clustersAPIPath, http.MethodGet, map[string]string{"name": name}, defaultPayload)
+	if err != nil {
+		return "", err
+	}
+	for _, clusterInfo := range existing.Path(jsonDataPath).Children() {
+		if getValue(clusterInfo, jsonNamePath, "") != name {
+			continue
+		}
+		if getStringMap(clusterInfo, jsonAnnotationsPath)[OwnerAnnotation] != ownerUID {
+			return "", fmt.Errorf("a cluster named '%s' that wasn't imported for this VerrazzanoManagedCluster already exists in Rancher", name)
+		}
+		zap.S().Infof("Cluster '%s' was already imported into Rancher", name)
+		return getValue(clusterInfo, jsonIDPath, ""), nil
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{"type": "cluster", "name": name, "annotations": map[string]string{OwnerAnnotation: ownerUID}})
+	if err != nil {
+		return "", err
+	}
+	zap.S().Infof("Importing cluster '%s' into Rancher", name)
+	created, err := r.APICall(rancherConfig, clustersAPIPath, http.MethodPost, defaultParameterMap, string(payload))
+	if err != nil {
+		return "", err
+	}
+	clusterID := getValue(created, jsonIDPath, "")
+	if clusterID == "" {
+		return "", fmt.Errorf("Rancher returned no ID for imported cluster '%s'", name)
+	}
+	return clusterID, nil
+}
+
+// GetRegistrationManifest returns the manifest of the Rancher agent that registers the imported cluster with the given
+// ID with Rancher once applied to it.  A registration token is only created if the cluster has none yet, so that
+// retries reuse the token of an earlier attempt.
+func GetRegistrationManifest(r rancher, rancherConfig Config, clusterID string) (string, error) {
+	exists, manifestURL, err := getRegistrationToken(r, rancherConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		payload, err := json.Marshal(map[string]string{"type": "clusterRegistrationToken", "clusterId": clusterID})
+		if err != nil {
+			return "", err
+		}
+		if _, err = r.APICall(rancherConfig, registrationTokensAPIPath, http.MethodPost, defaultParameterMap, string(payload)); err != nil {
+			return "", err
+		}
+	}
+
+	// Rancher fills in the manifest URL of the token asynchronously
+	if manifestURL == "" {
+		err = Retry(RegistrationWait, func() (bool, error) {
+			var tokenErr error
+			_, manifestURL, tokenErr = getRegistrationToken(r, rancherConfig, clusterID)
+			return manifestURL != "", tokenErr
+		})
+		if err == wait.ErrWaitTimeout {
+			return "", errors.New("timed out waiting for the Rancher agent manifest")
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The manifest is served by Rancher, download it through the configured Rancher address
+	parsedURL, err := url.Parse(manifestURL)
+	if err != nil {
+		return "", err
+	}
+	return r.Download(rancherConfig, parsedURL.RequestURI())
+}
+
+// Returns whether the cluster with the given ID has a registration token, and the manifest URL of the first token that
+// has one
+func getRegistrationToken(r rancher, rancherConfig Config, clusterID string) (bool, string, error) {
+	tokens, err := r.APICall(rancherConfig, registrationTokensAPIPath, http.MethodGet, map[string]string{"clusterId": clusterID}, defaultPayload)
+	if err != nil {
+		return false, "", err
+	}
+	children := tokens.Path(jsonDataPath).Children()
+	for _, token := range children {
+		if manifestURL := getValue(token, jsonManifestURL, ""); manifestURL != "" {
+			return true, manifestURL, nil
+		}
+	}
+	return len(children) > 0, "", nil
+}
@@ -0,0 +1,86 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Defines where the kubeconfigs of managed clusters are stored
+
+package secretbackend
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/kubeconfigs"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SecretBackend stores the kubeconfigs of VerrazzanoManagedCluster secrets.  The secret is always created, so that the
+// operator can track the credentials it holds, but a backend may keep the kubeconfig elsewhere and only record its
+// location on the secret.
+type SecretBackend interface {
+	// Name identifies the backend
+	Name() string
+	// Location returns the location of the kubeconfig of the secret with the given name, empty if kept in the secret
+	Location(secretName string) string
+	// Encode sets a kubeconfig on a desired secret, either as data or as a reference to the location Write stores it at
+	Encode(secret *corev1.Secret, kubeconfig []byte)
+	// Write stores the kubeconfig of an encoded secret before the secret is created/updated, if kept elsewhere
+	Write(secret *corev1.Secret, kubeconfig []byte) error
+	// Read returns the kubeconfig of a secret
+	Read(secret *corev1.Secret) ([]byte, error)
+	// Delete deletes the kubeconfig of a secret that is being deleted, if kept elsewhere
+	Delete(secret *corev1.Secret) error
+}
+
+// Kubernetes is the default backend, keeping kubeconfigs in the data of the secrets
+type Kubernetes struct{}
+
+// Name identifies the backend
+func (Kubernetes) Name() string {
+	return "kubernetes"
+}
+
+// Location is empty, the kubeconfig is kept in the secret
+func (Kubernetes) Location(secretName string) string {
+	return ""
+}
+
+// Encode sets the kubeconfig as the data of the secret, along with the server, CA and credentials it holds as separate
+// keys for consumers that don't parse kubeconfigs
+func (Kubernetes) Encode(secret *corev1.Secret, kubeconfig []byte) {
+	data, err := kubeconfigs.Split(kubeconfig)
+	if err != nil {
+		zap.S().Debugf("Unable to split the kubeconfig of secret %s/%s into keys: %v", secret.Namespace, secret.Name, err)
+		data = map[string][]byte{}
+	}
+	data[constants.KubeconfigSecretKey] = kubeconfig
+	secret.Data = data
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[constants.KubeconfigChecksumAnnotation] = Checksum(kubeconfig)
+}
+
+// Write is a no-op, the kubeconfig is written along with the secret
+func (Kubernetes) Write(secret *corev1.Secret, kubeconfig []byte) error {
+	return nil
+}
+
+// Read returns the kubeconfig in the data of the secret
+func (Kubernetes) Read(secret *corev1.Secret) ([]byte, error) {
+	if location, ok := secret.Annotations[constants.KubeconfigLocationAnnotation]; ok {
+		return nil, fmt.Errorf("kubeconfig of secret %s/%s is stored at %s, not in the secret", secret.Namespace, secret.Name, location)
+	}
+	return secret.Data[constants.KubeconfigSecretKey], nil
+}
+
+// Delete is a no-op, the kubeconfig is deleted along with the secret
+func (Kubernetes) Delete(secret *corev1.Secret) error {
+	return nil
+}
+
+// Checksum returns the checksum of a kubeconfig recorded by the KubeconfigChecksumAnnotation
+func Checksum(kubeconfig []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(kubeconfig))
+}
@@ -0,0 +1,205 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package secretbackend
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// vaultLocationScheme prefixes the locations of kubeconfigs stored in Vault
+const vaultLocationScheme = "vault://"
+
+// VaultConfig is the configuration of the Vault backend
+type VaultConfig struct {
+	// Address is the URL of the Vault server
+	Address string
+	// Token authenticates with Vault, unless TokenFile is set
+	Token string
+	// TokenFile is the file holding the token, read on every request so that renewed tokens are picked up
+	TokenFile string
+	// Mount is the mount path of the KV version 2 secrets engine
+	Mount string
+	// PathPrefix is the path under the mount that kubeconfigs are stored at, by secret name
+	PathPrefix string
+	// CACert is the PEM encoded CA certificate of the Vault server, the system roots are used if not set
+	CACert []byte
+	// Timeout is the timeout of Vault requests
+	Timeout time.Duration
+}
+
+// Vault is the backend keeping kubeconfigs in the KV version 2 secrets engine of HashiCorp Vault.  The secrets hold
+// no kubeconfig, only its location and checksum.
+type Vault struct {
+	config VaultConfig
+	client *http.Client
+}
+
+// vaultResponse is the part of Vault responses used by the backend
+type vaultResponse struct {
+	Data struct {
+		Data map[string]string `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// NewVault returns a Vault backend with the given configuration
+func NewVault(config VaultConfig) (*Vault, error) {
+	if config.Address == "" {
+		return nil, errors.New("vault address is required")
+	}
+	if config.Token == "" && config.TokenFile == "" {
+		return nil, errors.New("vault token or token file is required")
+	}
+	if config.Mount == "" {
+		return nil, errors.New("vault mount is required")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(config.CACert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CACert) {
+			return nil, errors.New("invalid Vault CA certificate")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	config.Mount = strings.Trim(config.Mount, "/")
+	config.PathPrefix = strings.Trim(config.PathPrefix, "/")
+	return &Vault{config: config, client: &http.Client{Transport: transport, Timeout: config.Timeout}}, nil
+}
+
+// Name identifies the backend
+func (v *Vault) Name() string {
+	return "vault"
+}
+
+// Location returns the Vault location of the kubeconfig of the secret with the given name
+func (v *Vault) Location(secretName string) string {
+	if v.config.PathPrefix == "" {
+		return vaultLocationScheme + v.config.Mount + "/" + secretName
+	}
+	return vaultLocationScheme + v.config.Mount + "/" + v.config.PathPrefix + "/" + secretName
+}
+
+// Encode records the location and checksum of the kubeconfig on the secret
+func (v *Vault) Encode(secret *corev1.Secret, kubeconfig []byte) {
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[constants.KubeconfigLocationAnnotation] = v.Location(secret.Name)
+	secret.Annotations[constants.KubeconfigChecksumAnnotation] = Checksum(kubeconfig)
+	secret.Data = nil
+}
+
+// Write stores the kubeconfig at the location of the secret
+func (v *Vault) Write(secret *corev1.Secret, kubeconfig []byte) error {
+	path, err := v.locationPath(secret)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string]interface{}{"data": map[string]string{constants.KubeconfigSecretKey: string(kubeconfig)}})
+	if err != nil {
+		return err
+	}
+	_, err = v.request(http.MethodPost, "/v1/"+v.config.Mount+"/data/"+path, body)
+	return err
+}
+
+// Read returns the kubeconfig at the location of the secret, or the kubeconfig in the data of secrets written before
+// the backend was configured
+func (v *Vault) Read(secret *corev1.Secret) ([]byte, error) {
+	if _, ok := secret.Annotations[constants.KubeconfigLocationAnnotation]; !ok {
+		return secret.Data[constants.KubeconfigSecretKey], nil
+	}
+	path, err := v.locationPath(secret)
+	if err != nil {
+		return nil, err
+	}
+	response, err := v.request(http.MethodGet, "/v1/"+v.config.Mount+"/data/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	kubeconfig, ok := response.Data.Data[constants.KubeconfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s has no %s key", path, constants.KubeconfigSecretKey)
+	}
+	return []byte(kubeconfig), nil
+}
+
+// Delete deletes all versions of the kubeconfig at the location of the secret
+func (v *Vault) Delete(secret *corev1.Secret) error {
+	if _, ok := secret.Annotations[constants.KubeconfigLocationAnnotation]; !ok {
+		return nil
+	}
+	path, err := v.locationPath(secret)
+	if err != nil {
+		return err
+	}
+	_, err = v.request(http.MethodDelete, "/v1/"+v.config.Mount+"/metadata/"+path, nil)
+	return err
+}
+
+// the path under the mount recorded as the location of the kubeconfig of a secret
+func (v *Vault) locationPath(secret *corev1.Secret) (string, error) {
+	location := secret.Annotations[constants.KubeconfigLocationAnnotation]
+	prefix := vaultLocationScheme + v.config.Mount + "/"
+	if !strings.HasPrefix(location, prefix) {
+		return "", fmt.Errorf("kubeconfig location %q of secret %s/%s is not in Vault mount %s", location, secret.Namespace, secret.Name, v.config.Mount)
+	}
+	return strings.TrimPrefix(location, prefix), nil
+}
+
+// send a request to Vault, a missing secret is not an error when deleting
+func (v *Vault) request(method string, path string, body []byte) (*vaultResponse, error) {
+	token := v.config.Token
+	if v.config.TokenFile != "" {
+		contents, err := ioutil.ReadFile(v.config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(contents))
+	}
+	req, err := http.NewRequest(method, v.config.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &vaultResponse{}
+	if len(contents) > 0 {
+		if err = json.Unmarshal(contents, response); err != nil {
+			return nil, fmt.Errorf("invalid response from Vault for %s %s: %v", method, path, err)
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodDelete {
+		return response, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("vault returned %d for %s %s: %s", resp.StatusCode, method, path, strings.Join(response.Errors, ", "))
+	}
+	return response, nil
+}
@@ -0,0 +1,227 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package secretbackend
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// devVault is an in-memory stand-in of a dev mode Vault server with a KV version 2 secrets engine mounted at secret/
+type devVault struct {
+	mu      sync.Mutex
+	token   string
+	secrets map[string]map[string]string
+	writes  int
+}
+
+func newDevVault(token string) (*devVault, *httptest.Server) {
+	vault := &devVault{token: token, secrets: map[string]map[string]string{}}
+	return vault, httptest.NewServer(vault)
+}
+
+func (v *devVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if r.Header.Get("X-Vault-Token") != v.token {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/") && r.Method == http.MethodPost:
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")] = body.Data
+		v.writes++
+		w.Write([]byte(`{"data":{"version":1}}`))
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/") && r.Method == http.MethodGet:
+		data, ok := v.secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/") && r.Method == http.MethodDelete:
+		path := strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/")
+		if _, ok := v.secrets[path]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(v.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestSecret() *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "verrazzano-managed-cluster-name", Namespace: constants.DefaultNamespace}}
+}
+
+func TestVault(t *testing.T) {
+	vault, server := newDevVault("root")
+	defer server.Close()
+	backend, err := NewVault(VaultConfig{Address: server.URL, Token: "root", Mount: "secret", PathPrefix: "/verrazzano/managed-clusters/", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secret := newTestSecret()
+	backend.Encode(secret, []byte("kubeconfig contents"))
+	if secret.Data != nil {
+		t.Fatalf("expected no kubeconfig in the secret, got %v", secret.Data)
+	}
+	location := "vault://secret/verrazzano/managed-clusters/verrazzano-managed-cluster-name"
+	if secret.Annotations[constants.KubeconfigLocationAnnotation] != location || backend.Location(secret.Name) != location {
+		t.Fatalf("expected location %s, got %v", location, secret.Annotations)
+	}
+	if secret.Annotations[constants.KubeconfigChecksumAnnotation] == "" {
+		t.Fatalf("expected a checksum, got %v", secret.Annotations)
+	}
+
+	if err = backend.Write(secret, []byte("kubeconfig contents")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vault.secrets["verrazzano/managed-clusters/verrazzano-managed-cluster-name"][constants.KubeconfigSecretKey] != "kubeconfig contents" {
+		t.Fatalf("expected the kubeconfig to be stored in Vault, got %v", vault.secrets)
+	}
+	kubeconfig, err := backend.Read(secret)
+	if err != nil || string(kubeconfig) != "kubeconfig contents" {
+		t.Fatalf("expected the stored kubeconfig, got %q, %v", kubeconfig, err)
+	}
+
+	if err = backend.Delete(secret); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(vault.secrets) != 0 {
+		t.Fatalf("expected the kubeconfig to be deleted from Vault, got %v", vault.secrets)
+	}
+	// Deleting again is not an error, reading is
+	if err = backend.Delete(secret); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = backend.Read(secret); err == nil {
+		t.Fatalf("expected an error reading a deleted kubeconfig")
+	}
+}
+
+func TestVaultReadsInlineKubeconfig(t *testing.T) {
+	_, server := newDevVault("root")
+	defer server.Close()
+	backend, err := NewVault(VaultConfig{Address: server.URL, Token: "root", Mount: "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Secrets written before the backend was configured hold the kubeconfig
+	secret := newTestSecret()
+	Kubernetes{}.Encode(secret, []byte("inline kubeconfig"))
+	kubeconfig, err := backend.Read(secret)
+	if err != nil || string(kubeconfig) != "inline kubeconfig" {
+		t.Fatalf("expected the inline kubeconfig, got %q, %v", kubeconfig, err)
+	}
+}
+
+func TestVaultTokenFile(t *testing.T) {
+	_, server := newDevVault("renewed")
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(tokenFile, []byte("expired\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	backend, err := NewVault(VaultConfig{Address: server.URL, TokenFile: tokenFile, Mount: "secret"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secret := newTestSecret()
+	backend.Encode(secret, []byte("kubeconfig"))
+	if err = backend.Write(secret, []byte("kubeconfig")); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected a permission error, got %v", err)
+	}
+	// The renewed token is picked up without restarting
+	if err = ioutil.WriteFile(tokenFile, []byte("renewed\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Write(secret, []byte("kubeconfig")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewVaultInvalid(t *testing.T) {
+	configs := []VaultConfig{
+		{Token: "root", Mount: "secret"},
+		{Address: "http://vault:8200", Mount: "secret"},
+		{Address: "http://vault:8200", Token: "root"},
+		{Address: "http://vault:8200", Token: "root", Mount: "secret", CACert: []byte("not a certificate")},
+	}
+	for _, config := range configs {
+		if _, err := NewVault(config); err == nil {
+			t.Errorf("expected an error for config %+v", config)
+		}
+	}
+}
+
+func TestKubernetes(t *testing.T) {
+	secret := newTestSecret()
+	Kubernetes{}.Encode(secret, []byte("kubeconfig"))
+	kubeconfig, err := Kubernetes{}.Read(secret)
+	if err != nil || string(kubeconfig) != "kubeconfig" {
+		t.Fatalf("expected the kubeconfig of the secret, got %q, %v", kubeconfig, err)
+	}
+	if secret.Annotations[constants.KubeconfigChecksumAnnotation] != Checksum([]byte("kubeconfig")) {
+		t.Fatalf("expected a checksum, got %v", secret.Annotations)
+	}
+
+	// The server and credentials of a valid kubeconfig are split into keys
+	contents := []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: target
+  cluster:
+    server: https://10.0.0.1:6443
+users:
+- name: admin
+  user:
+    token: admin-token
+contexts:
+- name: lab1
+  context:
+    cluster: target
+    user: admin
+current-context: lab1
+`)
+	Kubernetes{}.Encode(secret, contents)
+	if string(secret.Data[constants.KubeconfigSecretKey]) != string(contents) || string(secret.Data[constants.KubeconfigServerKey]) != "https://10.0.0.1:6443" ||
+		string(secret.Data[constants.KubeconfigTokenKey]) != "admin-token" {
+		t.Fatalf("expected the kubeconfig and its keys, got %v", secret.Data)
+	}
+	secret.Annotations = map[string]string{constants.KubeconfigLocationAnnotation: "vault://secret/name"}
+	if _, err = (Kubernetes{}).Read(secret); err == nil {
+		t.Fatalf("expected an error for a kubeconfig stored elsewhere")
+	}
+}
@@ -0,0 +1,357 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles generation of service account based kubeconfigs that access a managed cluster's API server directly
+
+package serviceaccount
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapiv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Names of the resources created in the managed cluster
+const (
+	Namespace        = "verrazzano-system"
+	Name             = "verrazzano-system"
+	TokenSecretName  = "verrazzano-system-token"
+	ClusterRoleName  = "verrazzano-system"
+	kubeconfigTarget = "managed-cluster"
+)
+
+// ErrNotBootstrapped is returned in dry-run mode when the service account does not exist in the managed cluster yet
+var ErrNotBootstrapped = errors.New("service account not bootstrapped in managed cluster")
+
+// TokenWait is how long to wait for the managed cluster to populate the service account token
+var TokenWait = wait.Backoff{
+	Steps:    10,
+	Duration: time.Second,
+	Factor:   1.5,
+}
+
+// CheckTimeout is the timeout of the request checking a stored service account kubeconfig
+var CheckTimeout = 10 * time.Second
+
+// LoadRules loads the rules of the ClusterRole bound to the service account from the verrazzano-system ClusterRole of
+// the given manifest, deploy/role.yaml
+func LoadRules(path string) ([]rbacv1.PolicyRule, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(contents)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no ClusterRole '%s' found in %s", ClusterRoleName, path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var clusterRole rbacv1.ClusterRole
+		if err = yaml.Unmarshal(doc, &clusterRole); err != nil {
+			return nil, fmt.Errorf("error loading %s: %v", path, err)
+		}
+		if clusterRole.Kind == "ClusterRole" && clusterRole.Name == ClusterRoleName {
+			return clusterRole.Rules, nil
+		}
+	}
+}
+
+// GenerateKubeconfig applies the service account, its RBAC and token to the managed cluster reached through the given
+// client, and returns a kubeconfig that uses the token to access the API server at serverAddress directly.  The
+// ClusterRole bound to the service account has the given rules.  In dry-run mode nothing is applied, and
+// ErrNotBootstrapped is returned if any of the resources are missing.
+func GenerateKubeconfig(managedClientSet kubernetes.Interface, rules []rbacv1.PolicyRule, serverAddress string, dryRun bool) (string, error) {
+	if serverAddress == "" || serverAddress == ":" {
+		return "", errors.New("managed cluster has no API server address")
+	}
+
+	for _, resource := range newResources(managedClientSet, rules) {
+		if err := resource.ensure(dryRun); err != nil {
+			return "", err
+		}
+	}
+
+	tokenSecret, err := waitForToken(managedClientSet)
+	if err != nil {
+		return "", err
+	}
+	return newKubeconfig(serverAddress, tokenSecret.Data[corev1.ServiceAccountRootCAKey], string(tokenSecret.Data[corev1.ServiceAccountTokenKey]))
+}
+
+// CheckKubeconfig returns an error unless the given kubeconfig accesses the API server at serverAddress with the
+// current token of the service account
+func CheckKubeconfig(kubeconfigContents string, serverAddress string) error {
+	kubeconfig, err := clientcmd.Load([]byte(kubeconfigContents))
+	if err != nil {
+		return err
+	}
+	currentContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return errors.New("kubeconfig has no current context")
+	}
+	cluster, ok := kubeconfig.Clusters[currentContext.Cluster]
+	if !ok || cluster.Server != "https://"+serverAddress {
+		return fmt.Errorf("kubeconfig does not access the API server at %s", serverAddress)
+	}
+	authInfo, ok := kubeconfig.AuthInfos[currentContext.AuthInfo]
+	if !ok {
+		return errors.New("kubeconfig has no credentials")
+	}
+	cfg, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Timeout = CheckTimeout
+	clientSet, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	return checkToken(clientSet, authInfo.Token)
+}
+
+// Returns an error unless the token is the current token of the service account, which the service account may read
+func checkToken(clientSet kubernetes.Interface, token string) error {
+	tokenSecret, err := clientSet.CoreV1().Secrets(Namespace).Get(context.TODO(), TokenSecretName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if token == "" || string(tokenSecret.Data[corev1.ServiceAccountTokenKey]) != token {
+		return fmt.Errorf("token of service account %s/%s was replaced", Namespace, Name)
+	}
+	return nil
+}
+
+// Hash identifies the resources applied to managed clusters for the service account with the given rules
+func Hash(rules []rbacv1.PolicyRule) (string, error) {
+	hash := sha256.New()
+	for _, obj := range Objects(rules) {
+		contents, err := json.Marshal(obj)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(contents)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Objects returns the service account and RBAC resources created in managed clusters, without the token secret.  The
+// ClusterRole bound to the service account has the given rules.
+func Objects(rules []rbacv1.PolicyRule) []runtime.Object {
+	return []runtime.Object{newNamespace(), newServiceAccount(), newClusterRole(rules), newClusterRoleBinding()}
+}
+
+func newNamespace() *corev1.Namespace {
+	return &corev1.Namespace{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+		ObjectMeta: metav1.ObjectMeta{Name: Namespace},
+	}
+}
+
+func newServiceAccount() *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: Name, Namespace: Namespace},
+	}
+}
+
+func newClusterRole(rules []rbacv1.PolicyRule) *rbacv1.ClusterRole {
+	return &rbacv1.ClusterRole{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+		ObjectMeta: metav1.ObjectMeta{Name: ClusterRoleName},
+		Rules:      rules,
+	}
+}
+
+func newClusterRoleBinding() *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+		ObjectMeta: metav1.ObjectMeta{Name: ClusterRoleName},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: ClusterRoleName},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: Name, Namespace: Namespace}},
+	}
+}
+
+func newTokenSecret() *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        TokenSecretName,
+			Namespace:   Namespace,
+			Annotations: map[string]string{corev1.ServiceAccountNameKey: Name},
+		},
+		Type: corev1.SecretTypeServiceAccountToken,
+	}
+}
+
+// resource is a resource applied to the managed cluster
+type resource struct {
+	kind   string
+	name   string
+	object runtime.Object
+	get    func() error
+	patch  func(patch []byte, options metav1.PatchOptions) error
+}
+
+// Returns the resources applied to the managed cluster, in apply order
+func newResources(clientSet kubernetes.Interface, rules []rbacv1.PolicyRule) []resource {
+	return []resource{
+		{
+			kind: "Namespace", name: Namespace, object: newNamespace(),
+			get: func() error {
+				_, err := clientSet.CoreV1().Namespaces().Get(context.TODO(), Namespace, metav1.GetOptions{})
+				return err
+			},
+			patch: func(patch []byte, options metav1.PatchOptions) error {
+				_, err := clientSet.CoreV1().Namespaces().Patch(context.TODO(), Namespace, types.ApplyPatchType, patch, options)
+				return err
+			},
+		},
+		{
+			kind: "ServiceAccount", name: Name, object: newServiceAccount(),
+			get: func() error {
+				_, err := clientSet.CoreV1().ServiceAccounts(Namespace).Get(context.TODO(), Name, metav1.GetOptions{})
+				return err
+			},
+			patch: func(patch []byte, options metav1.PatchOptions) error {
+				_, err := clientSet.CoreV1().ServiceAccounts(Namespace).Patch(context.TODO(), Name, types.ApplyPatchType, patch, options)
+				return err
+			},
+		},
+		{
+			kind: "ClusterRole", name: ClusterRoleName, object: newClusterRole(rules),
+			get: func() error {
+				_, err := clientSet.RbacV1().ClusterRoles().Get(context.TODO(), ClusterRoleName, metav1.GetOptions{})
+				return err
+			},
+			patch: func(patch []byte, options metav1.PatchOptions) error {
+				_, err := clientSet.RbacV1().ClusterRoles().Patch(context.TODO(), ClusterRoleName, types.ApplyPatchType, patch, options)
+				return err
+			},
+		},
+		{
+			kind: "ClusterRoleBinding", name: ClusterRoleName, object: newClusterRoleBinding(),
+			get: func() error {
+				_, err := clientSet.RbacV1().ClusterRoleBindings().Get(context.TODO(), ClusterRoleName, metav1.GetOptions{})
+				return err
+			},
+			patch: func(patch []byte, options metav1.PatchOptions) error {
+				_, err := clientSet.RbacV1().ClusterRoleBindings().Patch(context.TODO(), ClusterRoleName, types.ApplyPatchType, patch, options)
+				return err
+			},
+		},
+		{
+			kind: "Secret", name: TokenSecretName, object: newTokenSecret(),
+			get: func() error {
+				_, err := clientSet.CoreV1().Secrets(Namespace).Get(context.TODO(), TokenSecretName, metav1.GetOptions{})
+				return err
+			},
+			patch: func(patch []byte, options metav1.PatchOptions) error {
+				_, err := clientSet.CoreV1().Secrets(Namespace).Patch(context.TODO(), TokenSecretName, types.ApplyPatchType, patch, options)
+				return err
+			},
+		},
+	}
+}
+
+// Applies the resource with server-side apply, so that a resource that drifted is corrected.  In dry-run mode, the
+// resource is only checked to exist.
+func (r resource) ensure(dryRun bool) error {
+	if dryRun {
+		err := r.get()
+		if k8serrors.IsNotFound(err) {
+			return fmt.Errorf("%w: %s '%s' does not exist", ErrNotBootstrapped, r.kind, r.name)
+		}
+		return err
+	}
+	patch, err := json.Marshal(r.object)
+	if err != nil {
+		return err
+	}
+	zap.S().Debugf("Applying %s '%s' to managed cluster", r.kind, r.name)
+	force := true
+	if err = r.patch(patch, metav1.PatchOptions{FieldManager: constants.FieldManager, Force: &force}); err != nil {
+		return fmt.Errorf("error applying %s '%s': %v", r.kind, r.name, err)
+	}
+	return nil
+}
+
+// Waits for the token controller of the managed cluster to populate the service account token
+func waitForToken(clientSet kubernetes.Interface) (*corev1.Secret, error) {
+	var tokenSecret *corev1.Secret
+	err := wait.ExponentialBackoff(TokenWait, func() (bool, error) {
+		secret, err := clientSet.CoreV1().Secrets(Namespace).Get(context.TODO(), TokenSecretName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if len(secret.Data[corev1.ServiceAccountTokenKey]) == 0 {
+			return false, nil
+		}
+		tokenSecret = secret
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("timed out waiting for token of service account %s/%s", Namespace, Name)
+	}
+	return tokenSecret, err
+}
+
+// Constructs a kubeconfig accessing the API server at serverAddress with the given token
+func newKubeconfig(serverAddress string, caData []byte, token string) (string, error) {
+	kubeconfig := clientcmdapiv1.Config{
+		Kind:       "Config",
+		APIVersion: "v1",
+		Clusters: []clientcmdapiv1.NamedCluster{{
+			Name:    kubeconfigTarget,
+			Cluster: clientcmdapiv1.Cluster{Server: "https://" + serverAddress, CertificateAuthorityData: caData},
+		}},
+		AuthInfos: []clientcmdapiv1.NamedAuthInfo{{
+			Name:     kubeconfigTarget,
+			AuthInfo: clientcmdapiv1.AuthInfo{Token: token},
+		}},
+		Contexts: []clientcmdapiv1.NamedContext{{
+			Name:    kubeconfigTarget,
+			Context: clientcmdapiv1.Context{Cluster: kubeconfigTarget, AuthInfo: kubeconfigTarget},
+		}},
+		CurrentContext: kubeconfigTarget,
+	}
+	contents, err := yaml.Marshal(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
+
+// NewClientSet returns a clientset for the cluster accessed through the given kubeconfig
+func NewClientSet(kubeconfigContents string) (kubernetes.Interface, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfigContents))
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(cfg)
+}
@@ -0,0 +1,155 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package serviceaccount
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var testRules = []rbacv1.PolicyRule{{APIGroups: []string{"verrazzano.io"}, Resources: []string{"*"}, Verbs: []string{"*"}}}
+
+// The fake clientset supports neither server-side apply nor service account tokens, so apply patches replace the
+// object and populate the tokens of service account token secrets
+func addApplyReactor(clientSet *fake.Clientset) {
+	clientSet.PrependReactor("patch", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patchAction := action.(k8stesting.PatchAction)
+		if patchAction.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(patchAction.GetPatch(), nil, nil)
+		if err != nil {
+			return true, nil, err
+		}
+		if secret, ok := obj.(*corev1.Secret); ok && secret.Type == corev1.SecretTypeServiceAccountToken {
+			secret.Data = map[string][]byte{
+				corev1.ServiceAccountTokenKey:  []byte("sa-token"),
+				corev1.ServiceAccountRootCAKey: []byte("ca-data"),
+			}
+		}
+		tracker := clientSet.Tracker()
+		if _, err = tracker.Get(action.GetResource(), action.GetNamespace(), patchAction.GetName()); k8serrors.IsNotFound(err) {
+			return true, obj, tracker.Create(action.GetResource(), obj, action.GetNamespace())
+		}
+		return true, obj, tracker.Update(action.GetResource(), obj, action.GetNamespace())
+	})
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(filepath.Join("..", "..", "deploy", "role.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, rule := range rules {
+		if reflect.DeepEqual(rule.APIGroups, []string{"verrazzano.io"}) && reflect.DeepEqual(rule.Verbs, []string{"*"}) {
+			return
+		}
+	}
+	t.Fatalf("expected the rules of deploy/role.yaml to grant access to Verrazzano resources, got %v", rules)
+}
+
+func TestGenerateKubeconfig(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+	addApplyReactor(clientSet)
+
+	contents, err := GenerateKubeconfig(clientSet, testRules, "10.0.0.1:6443", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kubeconfig, err := clientcmd.Load([]byte(contents))
+	if err != nil {
+		t.Fatalf("unexpected error parsing kubeconfig: %v", err)
+	}
+	currentContext := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if kubeconfig.Clusters[currentContext.Cluster].Server != "https://10.0.0.1:6443" {
+		t.Fatalf("expected server https://10.0.0.1:6443, got %s", kubeconfig.Clusters[currentContext.Cluster].Server)
+	}
+	if string(kubeconfig.Clusters[currentContext.Cluster].CertificateAuthorityData) != "ca-data" {
+		t.Fatalf("expected the service account CA, got %s", kubeconfig.Clusters[currentContext.Cluster].CertificateAuthorityData)
+	}
+	if kubeconfig.AuthInfos[currentContext.AuthInfo].Token != "sa-token" {
+		t.Fatalf("expected the service account token, got %s", kubeconfig.AuthInfos[currentContext.AuthInfo].Token)
+	}
+
+	binding, err := clientSet.RbacV1().ClusterRoleBindings().Get(context.TODO(), ClusterRoleName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the ClusterRoleBinding to be created: %v", err)
+	}
+	if binding.Subjects[0].Name != Name || binding.Subjects[0].Namespace != Namespace {
+		t.Fatalf("unexpected ClusterRoleBinding subjects %v", binding.Subjects)
+	}
+
+	// A second call reuses the existing resources
+	again, err := GenerateKubeconfig(clientSet, testRules, "10.0.0.1:6443", false)
+	if err != nil || again != contents {
+		t.Fatalf("expected the same kubeconfig to be generated again, got error %v", err)
+	}
+	if err = checkToken(clientSet, kubeconfig.AuthInfos[currentContext.AuthInfo].Token); err != nil {
+		t.Fatalf("expected the kubeconfig token to be current, got %v", err)
+	}
+	if err = checkToken(clientSet, "replaced-token"); err == nil {
+		t.Fatalf("expected a replaced token to be rejected")
+	}
+}
+
+func TestGenerateKubeconfigCorrectsDrift(t *testing.T) {
+	drifted := newClusterRole(nil)
+	clientSet := fake.NewSimpleClientset(drifted)
+	addApplyReactor(clientSet)
+
+	if _, err := GenerateKubeconfig(clientSet, testRules, "10.0.0.1:6443", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clusterRole, err := clientSet.RbacV1().ClusterRoles().Get(context.TODO(), ClusterRoleName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(clusterRole.Rules, testRules) {
+		t.Fatalf("expected the rules of the existing ClusterRole to be corrected, got %v", clusterRole.Rules)
+	}
+}
+
+func TestCheckKubeconfigServerAddress(t *testing.T) {
+	contents, err := newKubeconfig("10.0.0.1:6443", nil, "sa-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = CheckKubeconfig(contents, "10.0.0.2:6443"); err == nil {
+		t.Fatalf("expected a kubeconfig of a previous API server address to be rejected")
+	}
+}
+
+func TestGenerateKubeconfigDryRun(t *testing.T) {
+	clientSet := fake.NewSimpleClientset()
+
+	_, err := GenerateKubeconfig(clientSet, testRules, "10.0.0.1:6443", true)
+	if !errors.Is(err, ErrNotBootstrapped) {
+		t.Fatalf("expected ErrNotBootstrapped, got %v", err)
+	}
+	for _, action := range clientSet.Actions() {
+		if action.GetVerb() != "get" {
+			t.Fatalf("expected no changes in dry-run mode, got %v", action)
+		}
+	}
+}
+
+func TestGenerateKubeconfigWithoutServerAddress(t *testing.T) {
+	if _, err := GenerateKubeconfig(fake.NewSimpleClientset(), testRules, ":", false); err == nil {
+		t.Fatalf("expected an error for a cluster without an API server address")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package source
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MultiSource combines the clusters of several sources
+type MultiSource struct {
+	sources []ClusterSource
+	// last are the clusters of the last successful call of each source by name, without their kubeconfigs
+	last map[string][]Cluster
+}
+
+// NewMultiSource returns a source of the clusters of all the given sources
+func NewMultiSource(sources ...ClusterSource) *MultiSource {
+	return &MultiSource{sources: sources, last: map[string][]Cluster{}}
+}
+
+// Name identifies the combined sources
+func (m *MultiSource) Name() string {
+	var names []string
+	for _, s := range m.sources {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, "+")
+}
+
+// IncompleteError is returned along with the clusters of the sources that succeeded when some sources fail
+type IncompleteError struct {
+	// Failures are the errors of the failed sources by name
+	Failures map[string]error
+	// Unknown is true if the clusters of a failed source are unknown, since it never succeeded.  Any registered
+	// cluster may belong to it, so none may be treated as deregistered.
+	Unknown bool
+}
+
+func (e *IncompleteError) Error() string {
+	var failures []string
+	for name, err := range e.Failures {
+		failures = append(failures, fmt.Sprintf("error getting clusters from %s: %v", name, err))
+	}
+	return strings.Join(failures, "; ")
+}
+
+// GetClusters returns the clusters of all the sources.  A failing source doesn't fail the others: the clusters it
+// returned last are returned in its place with Err set, so that they are kept without being synced, along with an
+// IncompleteError.  Not safe for concurrent use.
+func (m *MultiSource) GetClusters() ([]Cluster, error) {
+	var clusters []Cluster
+	var incomplete *IncompleteError
+	for _, s := range m.sources {
+		sourceClusters, err := s.GetClusters()
+		if err == nil {
+			m.remember(s.Name(), sourceClusters)
+			clusters = append(clusters, sourceClusters...)
+			continue
+		}
+		if incomplete == nil {
+			incomplete = &IncompleteError{Failures: map[string]error{}}
+		}
+		incomplete.Failures[s.Name()] = err
+		previous, ok := m.last[s.Name()]
+		incomplete.Unknown = incomplete.Unknown || !ok
+		for _, cluster := range previous {
+			cluster.Err = fmt.Errorf("cluster source %s is unavailable: %v", s.Name(), err)
+			clusters = append(clusters, cluster)
+		}
+	}
+	if incomplete != nil {
+		return clusters, incomplete
+	}
+	return clusters, nil
+}
+
+// Records the clusters of a successful call of the named source.  Their kubeconfigs aren't kept, the clusters are only
+// returned again to be kept while the source fails.
+func (m *MultiSource) remember(name string, clusters []Cluster) {
+	last := make([]Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		cluster.KubeConfigContents = ""
+		cluster.TokenName = ""
+		last = append(last, cluster)
+	}
+	m.last[name] = last
+}
@@ -0,0 +1,72 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package source
+
+import (
+	"errors"
+	"testing"
+)
+
+// fixed cluster source
+type testSource struct {
+	name     string
+	clusters []Cluster
+	err      error
+}
+
+func (s *testSource) Name() string {
+	return s.name
+}
+
+func (s *testSource) GetClusters() ([]Cluster, error) {
+	return s.clusters, s.err
+}
+
+func TestMultiSource(t *testing.T) {
+	multi := NewMultiSource(
+		&testSource{name: "rancher", clusters: []Cluster{{Name: "cluster1"}}},
+		&testSource{name: "capi", clusters: []Cluster{{Name: "cluster2"}, {Name: "cluster3"}}})
+	if multi.Name() != "rancher+capi" {
+		t.Fatalf("expected name rancher+capi, got %s", multi.Name())
+	}
+	clusters, err := multi.GetClusters()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(clusters) != 3 || clusters[0].Name != "cluster1" || clusters[2].Name != "cluster3" {
+		t.Fatalf("expected the clusters of all sources, got %v", clusters)
+	}
+
+}
+
+func TestMultiSourceFailure(t *testing.T) {
+	capi := &testSource{name: "capi", clusters: []Cluster{{ID: "c-2", Name: "cluster2", KubeConfigContents: "kubeconfig"}}}
+	multi := NewMultiSource(&testSource{name: "rancher", clusters: []Cluster{{ID: "c-1", Name: "cluster1"}}}, capi)
+
+	// The clusters of a source that never succeeded are unknown
+	capi.err = errors.New("unavailable")
+	clusters, err := multi.GetClusters()
+	incomplete, ok := err.(*IncompleteError)
+	if !ok || !incomplete.Unknown || incomplete.Failures["capi"] == nil {
+		t.Fatalf("expected the clusters of capi to be unknown, got %v", err)
+	}
+	if len(clusters) != 1 || clusters[0].Name != "cluster1" {
+		t.Fatalf("expected the clusters of the other sources, got %v", clusters)
+	}
+
+	// Once it succeeded, its last clusters are returned with the error while it fails
+	capi.err = nil
+	if _, err = multi.GetClusters(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	capi.err = errors.New("unavailable")
+	clusters, err = multi.GetClusters()
+	incomplete, ok = err.(*IncompleteError)
+	if !ok || incomplete.Unknown {
+		t.Fatalf("expected the clusters of capi to be known, got %v", err)
+	}
+	if len(clusters) != 2 || clusters[0].Err != nil || clusters[1].ID != "c-2" || clusters[1].Err == nil || clusters[1].KubeConfigContents != "" {
+		t.Fatalf("expected the last clusters of capi to be returned failed, got %v", clusters)
+	}
+}
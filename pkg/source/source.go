@@ -0,0 +1,40 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Defines the inventory sources that feed managed clusters to the operator
+
+package source
+
+// Cluster contains the details of a managed cluster obtained from a cluster source
+type Cluster struct {
+	ID string
+	// Name is the name of the resources generated for the cluster, see package naming
+	Name string
+	// DisplayName is the name of the cluster in its source
+	DisplayName        string
+	KubeConfigContents string
+	PrometheusURL      string
+	ServerAddress      string
+	Type               string
+	// Labels and Annotations are the labels and annotations of the cluster in its source
+	Labels      map[string]string
+	Annotations map[string]string
+	// TokenName is the name of the Rancher token embedded in KubeConfigContents, if any
+	TokenName string
+	// SecretName is the name of the kubeconfig secret generated for the cluster, see package naming
+	SecretName string
+	// ResourceLabels and ResourceAnnotations are added to the resources generated for the cluster
+	ResourceLabels      map[string]string
+	ResourceAnnotations map[string]string
+	// Err is the error getting the details of the cluster from its source, such as generating its kubeconfig.  The
+	// cluster is still registered, so its resources are kept, but it isn't synced until its details are available.
+	Err error
+}
+
+// ClusterSource is an inventory of managed clusters, such as Rancher
+type ClusterSource interface {
+	// Name identifies the source in logs and events
+	Name() string
+	// GetClusters returns the clusters currently in the inventory
+	GetClusters() ([]Cluster, error)
+}
@@ -4,8 +4,12 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+
 	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // GetManagedClusterKubeconfigSecretName returns the secret for a managed cluster
@@ -14,6 +18,20 @@ func GetManagedClusterKubeconfigSecretName(clusterID string) string {
 }
 
 // GetManagedClusterLabels return labels for a managed cluster
-func GetManagedClusterLabels(managedClusterID string) map[string]string {
-	return map[string]string{constants.K8SAppLabel: constants.VerrazzanoGroup, constants.VerrazzanoClusterLabel: managedClusterID}
+func GetManagedClusterLabels(clusterName string, clusterID string) map[string]string {
+	labels := map[string]string{constants.K8SAppLabel: constants.VerrazzanoGroup, constants.VerrazzanoClusterLabel: clusterName}
+	if clusterID != "" {
+		labels[constants.ClusterIDLabel] = GetClusterIDLabelValue(clusterID)
+	}
+	return labels
+}
+
+// GetClusterIDLabelValue returns the value of the cluster ID label for a managed cluster.  IDs that aren't valid label
+// values are replaced by their hash.
+func GetClusterIDLabelValue(clusterID string) string {
+	if len(validation.IsValidLabelValue(clusterID)) == 0 {
+		return clusterID
+	}
+	sum := sha256.Sum256([]byte(clusterID))
+	return "sha256-" + hex.EncodeToString(sum[:])[:validation.LabelValueMaxLength-len("sha256-")]
 }
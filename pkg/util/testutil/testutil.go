@@ -0,0 +1,50 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Fixtures shared by the unit tests of several packages
+
+package testutil
+
+import (
+	"testing"
+
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	listers "github.com/verrazzano/verrazzano-crd-generator/pkg/client/listers/verrazzano/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewIndexer returns a namespace indexer containing the given objects, for listers whose contents change during a test
+func NewIndexer(t *testing.T, objects ...interface{}) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, object := range objects {
+		if err := indexer.Add(object); err != nil {
+			t.Fatalf("unexpected error adding %T to indexer: %v", object, err)
+		}
+	}
+	return indexer
+}
+
+// NewSecretLister returns a secret lister backed by an indexer containing the given secrets
+func NewSecretLister(t *testing.T, secrets ...*corev1.Secret) corev1listers.SecretLister {
+	indexer := NewIndexer(t)
+	for _, secret := range secrets {
+		if err := indexer.Add(secret); err != nil {
+			t.Fatalf("unexpected error adding secret to indexer: %v", err)
+		}
+	}
+	return corev1listers.NewSecretLister(indexer)
+}
+
+// NewVerrazzanoManagedClusterLister returns a VerrazzanoManagedCluster lister backed by an indexer containing the
+// given resources
+func NewVerrazzanoManagedClusterLister(t *testing.T, vmcs ...*v1beta1.VerrazzanoManagedCluster) listers.VerrazzanoManagedClusterLister {
+	indexer := NewIndexer(t)
+	for _, vmc := range vmcs {
+		if err := indexer.Add(vmc); err != nil {
+			t.Fatalf("unexpected error adding VerrazzanoManagedCluster to indexer: %v", err)
+		}
+	}
+	return listers.NewVerrazzanoManagedClusterLister(indexer)
+}
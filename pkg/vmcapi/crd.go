@@ -0,0 +1,186 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package vmcapi
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	"go.uber.org/zap"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// CRDRevision is the revision of the definition returned by NewCRD, increased whenever the definition changes
+const CRDRevision = 1
+
+// crdPollInterval is the interval to check whether an installed CRD is established
+const crdPollInterval = time.Second
+
+// NewCRD returns the VerrazzanoManagedCluster CustomResourceDefinition installed by the operator
+func NewCRD() *apiextensionsv1.CustomResourceDefinition {
+	stringProperty := func(description string) apiextensionsv1.JSONSchemaProps {
+		return apiextensionsv1.JSONSchemaProps{Type: "string", Description: description}
+	}
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        CRDName,
+			Annotations: map[string]string{constants.CRDRevisionAnnotation: strconv.Itoa(CRDRevision)},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: v1beta1.SchemeGroupVersion.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     Resource,
+				Singular:   "verrazzanomanagedcluster",
+				Kind:       Kind,
+				ListKind:   Kind + "List",
+				ShortNames: []string{"vmc", "vmcs"},
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    V1beta1,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type:        "object",
+						Description: "VerrazzanoManagedCluster is the Schema for the Verrazzanomanagedclusters API",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"apiVersion": stringProperty("APIVersion defines the versioned schema of this representation of an object."),
+							"kind":       stringProperty("Kind is a string value representing the REST resource this object represents."),
+							"metadata":   {Type: "object"},
+							"spec": {
+								Type:        "object",
+								Description: "VerrazzanoManagedClusterSpec defines the desired state of VerrazzanoManagedCluster",
+								Required:    []string{"kubeconfigSecret", "serverAddress", "type"},
+								Properties: map[string]apiextensionsv1.JSONSchemaProps{
+									"description":      stringProperty("The description of the managed cluster"),
+									"serverAddress":    stringProperty("The server address"),
+									"type":             stringProperty("The type of managed cluster"),
+									"kubeconfigSecret": stringProperty("The secret containing the KUBECONFIG for the managed cluster"),
+								},
+							},
+							"status": {
+								Type:        "object",
+								Description: "VerrazzanoManagedClusterStatus defines the observed state of VerrazzanoManagedCluster",
+							},
+						},
+					},
+				},
+				Subresources: &apiextensionsv1.CustomResourceSubresources{Status: &apiextensionsv1.CustomResourceSubresourceStatus{}},
+			}},
+		},
+	}
+}
+
+// EnsureCRD installs the definition of NewCRD, or upgrades an older definition installed by the operator to it, and
+// waits up to the given timeout for the definition to be established.  A definition of a newer revision, or one the
+// operator didn't install such as the definition of the Verrazzano installation, is left alone, an error is returned if
+// it serves none of the supported API versions.
+func EnsureCRD(kubeExtClientSet apiextensionsclient.Interface, timeout time.Duration) error {
+	crds := kubeExtClientSet.ApiextensionsV1().CustomResourceDefinitions()
+	desired := NewCRD()
+	existing, err := crds.Get(context.TODO(), CRDName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		zap.S().Infof("Installing CustomResourceDefinition %s revision %d", CRDName, CRDRevision)
+		if _, err = crds.Create(context.TODO(), desired, metav1.CreateOptions{FieldManager: constants.FieldManager}); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		revision, installed, err := getCRDRevision(existing)
+		if err != nil {
+			return err
+		}
+		if !installed {
+			if err = CheckServedVersion(kubeExtClientSet); err != nil {
+				return fmt.Errorf("CustomResourceDefinition %s was not installed by the operator and is incompatible: %v", CRDName, err)
+			}
+			zap.S().Infof("Keeping CustomResourceDefinition %s, it was not installed by the operator", CRDName)
+		} else if revision > CRDRevision {
+			if err = CheckServedVersion(kubeExtClientSet); err != nil {
+				return fmt.Errorf("CustomResourceDefinition %s revision %d is newer than revision %d and incompatible: %v", CRDName, revision, CRDRevision, err)
+			}
+			zap.S().Infof("Keeping CustomResourceDefinition %s revision %d, newer than revision %d", CRDName, revision, CRDRevision)
+		} else if revision < CRDRevision {
+			zap.S().Infof("Upgrading CustomResourceDefinition %s from revision %d to revision %d", CRDName, revision, CRDRevision)
+			if _, err = crds.Update(context.TODO(), upgradeCRD(existing, desired), metav1.UpdateOptions{FieldManager: constants.FieldManager}); err != nil {
+				return err
+			}
+		}
+	}
+	return waitForCRD(kubeExtClientSet, timeout)
+}
+
+// Returns the revision of an existing definition, and false if it was not installed by the operator
+func getCRDRevision(crd *apiextensionsv1.CustomResourceDefinition) (int, bool, error) {
+	value, ok := crd.Annotations[constants.CRDRevisionAnnotation]
+	if !ok {
+		return 0, false, nil
+	}
+	revision, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid %s annotation %q on CustomResourceDefinition %s", constants.CRDRevisionAnnotation, value, CRDName)
+	}
+	return revision, true, nil
+}
+
+// Returns the existing definition, installed by the operator, upgraded to the desired one.  Versions only of the
+// existing definition are kept so that the objects stored in them remain readable, but are no longer the storage
+// version.
+func upgradeCRD(existing *apiextensionsv1.CustomResourceDefinition, desired *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+	upgraded := existing.DeepCopy()
+	if upgraded.Annotations == nil {
+		upgraded.Annotations = map[string]string{}
+	}
+	for key, value := range desired.Annotations {
+		upgraded.Annotations[key] = value
+	}
+	versions := desired.Spec.Versions
+	for _, version := range existing.Spec.Versions {
+		found := false
+		for _, desiredVersion := range desired.Spec.Versions {
+			found = found || desiredVersion.Name == version.Name
+		}
+		if !found {
+			version.Storage = false
+			versions = append(versions, version)
+		}
+	}
+	upgraded.Spec = desired.Spec
+	upgraded.Spec.Versions = versions
+	return upgraded
+}
+
+// Waits for the definition to be established, failing early if its names are not accepted
+func waitForCRD(kubeExtClientSet apiextensionsclient.Interface, timeout time.Duration) error {
+	err := wait.PollImmediate(crdPollInterval, timeout, func() (bool, error) {
+		crd, err := kubeExtClientSet.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), CRDName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range crd.Status.Conditions {
+			if condition.Type == apiextensionsv1.NamesAccepted && condition.Status == apiextensionsv1.ConditionFalse {
+				return false, fmt.Errorf("names of CustomResourceDefinition %s not accepted: %s", CRDName, condition.Message)
+			}
+			if condition.Type == apiextensionsv1.Established && condition.Status == apiextensionsv1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out after %v waiting for CustomResourceDefinition %s to be established", timeout, CRDName)
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package vmcapi
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	fakeapiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Returns a fake clientset whose created and updated CRDs are established, like the API server does
+func newEstablishingClientSet(objects ...runtime.Object) *fakeapiextensions.Clientset {
+	clientSet := fakeapiextensions.NewSimpleClientset(objects...)
+	establish := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		crd := action.(interface{ GetObject() runtime.Object }).GetObject().(*apiextensionsv1.CustomResourceDefinition)
+		crd.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue}}
+		return false, nil, nil
+	}
+	clientSet.PrependReactor("create", "customresourcedefinitions", establish)
+	clientSet.PrependReactor("update", "customresourcedefinitions", establish)
+	return clientSet
+}
+
+func getCRD(t *testing.T, clientSet *fakeapiextensions.Clientset) *apiextensionsv1.CustomResourceDefinition {
+	crd, err := clientSet.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), CRDName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return crd
+}
+
+func TestEnsureCRDInstalls(t *testing.T) {
+	clientSet := newEstablishingClientSet()
+	if err := EnsureCRD(clientSet, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	crd := getCRD(t, clientSet)
+	if crd.Annotations[constants.CRDRevisionAnnotation] != "1" || len(crd.Spec.Versions) != 1 || !crd.Spec.Versions[0].Storage {
+		t.Fatalf("unexpected installed CRD %v", crd)
+	}
+	if err := CheckServedVersion(clientSet); err != nil {
+		t.Fatalf("expected the installed CRD to serve %s, got %v", V1beta1, err)
+	}
+}
+
+func TestEnsureCRDUpgrades(t *testing.T) {
+	// An older definition installed by the operator is upgraded, keeping the versions it stores objects in
+	existing := newCRD(V1beta1, "v1alpha1")
+	existing.Annotations = map[string]string{constants.CRDRevisionAnnotation: "0"}
+	existing.Spec.Versions[0].Storage = false
+	existing.Spec.Versions = append(existing.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1alpha1", Served: true, Storage: true})
+	clientSet := newEstablishingClientSet(existing)
+	if err := EnsureCRD(clientSet, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	crd := getCRD(t, clientSet)
+	if crd.Annotations[constants.CRDRevisionAnnotation] != "1" {
+		t.Fatalf("expected the CRD to be upgraded, got %v", crd.Annotations)
+	}
+	storage := map[string]bool{}
+	for _, version := range crd.Spec.Versions {
+		storage[version.Name] = version.Storage
+	}
+	if !storage[V1beta1] || storage["v1alpha1"] {
+		t.Fatalf("expected %s to become the storage version, got %v", V1beta1, crd.Spec.Versions)
+	}
+}
+
+func TestEnsureCRDKeepsUnownedDefinition(t *testing.T) {
+	// The definition of the Verrazzano installation carries no revision, its schema is left alone
+	existing := newCRD(V1beta1)
+	existing.Spec.Versions[0].Schema = &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", Description: "installed by Verrazzano"}}
+	existing.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue}}
+	clientSet := newEstablishingClientSet(existing)
+	if err := EnsureCRD(clientSet, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, action := range clientSet.Actions() {
+		if action.GetVerb() != "get" {
+			t.Fatalf("expected a CRD not installed by the operator to be left alone, got %v", clientSet.Actions())
+		}
+	}
+
+	// Unless it serves no supported version
+	if err := EnsureCRD(newEstablishingClientSet(newCRD("v2alpha1")), time.Second); err == nil || !strings.Contains(err.Error(), "not installed by the operator") {
+		t.Fatalf("expected an incompatible CRD error, got %v", err)
+	}
+}
+
+func TestEnsureCRDKeepsNewerRevision(t *testing.T) {
+	existing := newCRD(V1beta1)
+	existing.Annotations = map[string]string{constants.CRDRevisionAnnotation: "2"}
+	existing.Status.Conditions = []apiextensionsv1.CustomResourceDefinitionCondition{{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue}}
+	clientSet := newEstablishingClientSet(existing)
+	if err := EnsureCRD(clientSet, time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, action := range clientSet.Actions() {
+		if action.GetVerb() != "get" {
+			t.Fatalf("expected a newer CRD to be left alone, got %v", clientSet.Actions())
+		}
+	}
+
+	// A newer definition serving no supported version is refused
+	existing = newCRD("v2alpha1")
+	existing.Annotations = map[string]string{constants.CRDRevisionAnnotation: "2"}
+	if err := EnsureCRD(newEstablishingClientSet(existing), time.Second); err == nil || !strings.Contains(err.Error(), "incompatible") {
+		t.Fatalf("expected an incompatible CRD error, got %v", err)
+	}
+}
+
+func TestEnsureCRDTimesOut(t *testing.T) {
+	clientSet := fakeapiextensions.NewSimpleClientset()
+	if err := EnsureCRD(clientSet, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected a timeout waiting for the CRD to be established, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles the API versions of VerrazzanoManagedClusters served by the admin cluster
+
+package vmcapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CRDName is the name of the VerrazzanoManagedCluster CustomResourceDefinition
+const CRDName = "verrazzanomanagedclusters.verrazzano.io"
+
+// Kind is the kind of VerrazzanoManagedClusters
+const Kind = "VerrazzanoManagedCluster"
+
+// V1beta1 is the API version of the verrazzano-crd-generator types the operator works with, the only version
+// Verrazzano defines
+const V1beta1 = "v1beta1"
+
+// Resource is the resource of VerrazzanoManagedClusters
+const Resource = "verrazzanomanagedclusters"
+
+// CheckServedVersion returns an error unless the admin cluster serves VerrazzanoManagedClusters as v1beta1
+func CheckServedVersion(kubeExtClientSet apiextensionsclient.Interface) error {
+	crd, err := kubeExtClientSet.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), CRDName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	var served []string
+	for _, version := range crd.Spec.Versions {
+		if version.Served {
+			if version.Name == V1beta1 {
+				return nil
+			}
+			served = append(served, version.Name)
+		}
+	}
+	return fmt.Errorf("CustomResourceDefinition %s serves versions [%s], not %s", CRDName, strings.Join(served, ","), V1beta1)
+}
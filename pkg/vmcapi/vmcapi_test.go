@@ -0,0 +1,40 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package vmcapi
+
+import (
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	fakeapiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Returns a VerrazzanoManagedCluster CRD serving the given versions
+func newCRD(served ...string) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: CRDName}}
+	for _, version := range []string{V1beta1, "v2alpha1"} {
+		crdVersion := apiextensionsv1.CustomResourceDefinitionVersion{Name: version}
+		for _, name := range served {
+			crdVersion.Served = crdVersion.Served || name == version
+		}
+		crd.Spec.Versions = append(crd.Spec.Versions, crdVersion)
+	}
+	return crd
+}
+
+func TestCheckServedVersion(t *testing.T) {
+	for _, served := range [][]string{{V1beta1}, {V1beta1, "v2alpha1"}} {
+		if err := CheckServedVersion(fakeapiextensions.NewSimpleClientset(newCRD(served...))); err != nil {
+			t.Errorf("expected no error when serving %v, got %v", served, err)
+		}
+	}
+
+	if err := CheckServedVersion(fakeapiextensions.NewSimpleClientset(newCRD("v2alpha1"))); err == nil {
+		t.Errorf("expected an error when not serving %s", V1beta1)
+	}
+	if err := CheckServedVersion(fakeapiextensions.NewSimpleClientset()); err == nil {
+		t.Errorf("expected an error without the CRD")
+	}
+}
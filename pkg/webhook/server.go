@@ -0,0 +1,139 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/vmcapi"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	"go.uber.org/zap"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConfigurationName is the name of the ValidatingWebhookConfiguration registering the webhook
+const ConfigurationName = "verrazzano-cluster-operator"
+
+// webhookName is the name of the webhook in the ValidatingWebhookConfiguration
+const webhookName = "validate.verrazzanomanagedclusters.verrazzano.io"
+
+// Config configures the webhook server
+type Config struct {
+	// Port is the port the webhook server listens on
+	Port int
+	// ServiceName is the name of the Service routing the API server to the webhook server
+	ServiceName string
+	// ServiceNamespace is the namespace of the Service
+	ServiceNamespace string
+	// OperatorUser is the user name of the operator, whose own edits are always allowed
+	OperatorUser string
+}
+
+// Server serves the validating webhook over TLS, with certificates generated on startup
+type Server struct {
+	config       Config
+	certificates *Certificates
+	server       *http.Server
+	listener     net.Listener
+}
+
+// NewServer returns a webhook server with newly generated certificates
+func NewServer(config Config) (*Server, error) {
+	certificates, err := GenerateCertificates(config.ServiceName, config.ServiceNamespace, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the webhook certificates: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, &Validator{OperatorUser: config.OperatorUser})
+	return &Server{
+		config:       config,
+		certificates: certificates,
+		server: &http.Server{
+			Addr:      fmt.Sprintf(":%d", config.Port),
+			Handler:   mux,
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{certificates.Serving}, MinVersion: tls.VersionTLS12},
+		},
+	}, nil
+}
+
+// Register applies the ValidatingWebhookConfiguration trusting the CA of the server
+func (s *Server) Register(kubeClientSet kubernetes.Interface) error {
+	patch, err := json.Marshal(s.newConfiguration())
+	if err != nil {
+		return err
+	}
+	force := true
+	_, err = kubeClientSet.AdmissionregistrationV1().ValidatingWebhookConfigurations().Patch(context.TODO(), ConfigurationName, types.ApplyPatchType, patch,
+		metav1.PatchOptions{FieldManager: constants.FieldManager, Force: &force})
+	return err
+}
+
+// Start serves the webhook until the stop channel is closed.  The listener is bound before it returns, so that the
+// webhook can be registered right away.
+func (s *Server) Start(stopCh <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	go func() {
+		zap.S().Infof("Serving the VerrazzanoManagedCluster validating webhook on %s", listener.Addr())
+		if err := s.server.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
+			zap.S().Errorf("Failed to serve the validating webhook, for the reason (%v)", err)
+		}
+	}()
+	go func() {
+		<-stopCh
+		s.server.Shutdown(context.Background())
+	}()
+	return nil
+}
+
+// Constructs the ValidatingWebhookConfiguration of the webhook.  Edits are allowed while the operator is down, so
+// that VerrazzanoManagedClusters remain editable after it is uninstalled.
+func (s *Server) newConfiguration() *admissionregistrationv1.ValidatingWebhookConfiguration {
+	path := ValidatePath
+	port := int32(s.config.Port)
+	failurePolicy := admissionregistrationv1.Ignore
+	matchPolicy := admissionregistrationv1.Equivalent
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	timeoutSeconds := int32(10)
+	return &admissionregistrationv1.ValidatingWebhookConfiguration{
+		TypeMeta:   metav1.TypeMeta{APIVersion: admissionregistrationv1.SchemeGroupVersion.String(), Kind: "ValidatingWebhookConfiguration"},
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigurationName},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{{
+			Name: webhookName,
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service:  &admissionregistrationv1.ServiceReference{Namespace: s.config.ServiceNamespace, Name: s.config.ServiceName, Path: &path, Port: &port},
+				CABundle: s.certificates.CABundle,
+			},
+			Rules: []admissionregistrationv1.RuleWithOperations{{
+				Operations: []admissionregistrationv1.OperationType{admissionregistrationv1.Update},
+				Rule: admissionregistrationv1.Rule{
+					APIGroups:   []string{v1beta1.SchemeGroupVersion.Group},
+					APIVersions: []string{vmcapi.V1beta1},
+					Resources:   []string{vmcapi.Resource},
+				},
+			}},
+			ObjectSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: constants.ClusterIDLabel, Operator: metav1.LabelSelectorOpExists}},
+			},
+			FailurePolicy:           &failurePolicy,
+			MatchPolicy:             &matchPolicy,
+			SideEffects:             &sideEffects,
+			TimeoutSeconds:          &timeoutSeconds,
+			AdmissionReviewVersions: []string{"v1"},
+		}},
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+// Handles the validating admission webhook protecting the VerrazzanoManagedCluster fields owned by the operator
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	"go.uber.org/zap"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ValidatePath is the path the webhook server validates VerrazzanoManagedClusters at
+const ValidatePath = "/validate-verrazzanomanagedcluster"
+
+// Validator rejects edits to the spec fields the operator owns on the VerrazzanoManagedClusters it generates, which
+// the operator would otherwise silently overwrite on its next poll
+type Validator struct {
+	// OperatorUser is the user name of the operator, whose own edits are always allowed
+	OperatorUser string
+}
+
+// ServeHTTP handles AdmissionReview requests
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err = json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("invalid AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	review.Response = v.Validate(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	response, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// Validate allows or denies an admission request of a VerrazzanoManagedCluster
+func (v *Validator) Validate(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	if request.Operation != admissionv1.Update || request.UserInfo.Username == v.OperatorUser {
+		return allowed()
+	}
+	oldVmc := &v1beta1.VerrazzanoManagedCluster{}
+	if err := json.Unmarshal(request.OldObject.Raw, oldVmc); err != nil {
+		return denied(http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("invalid VerrazzanoManagedCluster: %v", err))
+	}
+	vmc := &v1beta1.VerrazzanoManagedCluster{}
+	if err := json.Unmarshal(request.Object.Raw, vmc); err != nil {
+		return denied(http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("invalid VerrazzanoManagedCluster: %v", err))
+	}
+	// Only the resources generated by the operator are protected
+	if _, ok := oldVmc.Labels[constants.ClusterIDLabel]; !ok {
+		return allowed()
+	}
+	if vmc.Annotations[constants.AllowManualEditAnnotation] == "true" {
+		zap.S().Infof("Allowing %s to edit VerrazzanoManagedCluster '%s' annotated %s", request.UserInfo.Username, vmc.Name, constants.AllowManualEditAnnotation)
+		return allowed()
+	}
+	var changed []string
+	if vmc.Spec.ServerAddress != oldVmc.Spec.ServerAddress {
+		changed = append(changed, "spec.serverAddress")
+	}
+	if vmc.Spec.KubeconfigSecret != oldVmc.Spec.KubeconfigSecret {
+		changed = append(changed, "spec.kubeconfigSecret")
+	}
+	if vmc.Spec.Type != oldVmc.Spec.Type {
+		changed = append(changed, "spec.type")
+	}
+	if len(changed) == 0 {
+		return allowed()
+	}
+	zap.S().Infof("Denying %s the edit of %s of VerrazzanoManagedCluster '%s'", request.UserInfo.Username, strings.Join(changed, ", "), vmc.Name)
+	return denied(http.StatusForbidden, metav1.StatusReasonForbidden, fmt.Sprintf("%s of VerrazzanoManagedCluster %s are managed by the verrazzano-cluster-operator and would be overwritten, annotate the resource with %s=true to edit them anyway",
+		strings.Join(changed, ", "), vmc.Name, constants.AllowManualEditAnnotation))
+}
+
+func allowed() *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func denied(code int32, reason metav1.StatusReason, message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result:  &metav1.Status{Status: metav1.StatusFailure, Code: code, Reason: reason, Message: message},
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/verrazzano/verrazzano-cluster-operator/pkg/constants"
+	"github.com/verrazzano/verrazzano-crd-generator/pkg/apis/verrazzano/v1beta1"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Returns a VerrazzanoManagedCluster generated by the operator
+func newVerrazzanoManagedCluster() *v1beta1.VerrazzanoManagedCluster {
+	return &v1beta1.VerrazzanoManagedCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: constants.DefaultNamespace, Labels: map[string]string{constants.ClusterIDLabel: "id"}},
+		Spec:       v1beta1.VerrazzanoManagedClusterSpec{ServerAddress: "10.0.0.1:6443", Type: "rancher", KubeconfigSecret: "verrazzano-managed-cluster-name"},
+	}
+}
+
+// Returns an update request of a VerrazzanoManagedCluster by the given user
+func newUpdateRequest(t *testing.T, user string, oldVmc *v1beta1.VerrazzanoManagedCluster, vmc *v1beta1.VerrazzanoManagedCluster) *admissionv1.AdmissionRequest {
+	oldRaw, err := json.Marshal(oldVmc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(vmc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admissionv1.AdmissionRequest{
+		UID:       "uid",
+		Operation: admissionv1.Update,
+		UserInfo:  authenticationv1.UserInfo{Username: user},
+		OldObject: runtime.RawExtension{Raw: oldRaw},
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	validator := &Validator{OperatorUser: constants.OperatorUser}
+	edited := newVerrazzanoManagedCluster()
+	edited.Spec.ServerAddress = "10.0.0.2:6443"
+	edited.Spec.Type = "olcne"
+
+	response := validator.Validate(newUpdateRequest(t, "kubernetes-admin", newVerrazzanoManagedCluster(), edited))
+	if response.Allowed || !strings.Contains(response.Result.Message, "spec.serverAddress, spec.type") || response.Result.Code != http.StatusForbidden {
+		t.Fatalf("expected the edit of operator owned fields to be denied, got %v", response)
+	}
+
+	// The operator itself may edit them
+	if response = validator.Validate(newUpdateRequest(t, constants.OperatorUser, newVerrazzanoManagedCluster(), edited)); !response.Allowed {
+		t.Fatalf("expected the edit by the operator to be allowed, got %v", response.Result)
+	}
+
+	// Users may edit them with the override annotation
+	edited.Annotations = map[string]string{constants.AllowManualEditAnnotation: "true"}
+	if response = validator.Validate(newUpdateRequest(t, "kubernetes-admin", newVerrazzanoManagedCluster(), edited)); !response.Allowed {
+		t.Fatalf("expected the annotated edit to be allowed, got %v", response.Result)
+	}
+
+	// Edits of other fields are allowed
+	labelled := newVerrazzanoManagedCluster()
+	labelled.Labels["team"] = "lab"
+	labelled.Spec.Description = "lab cluster"
+	if response = validator.Validate(newUpdateRequest(t, "kubernetes-admin", newVerrazzanoManagedCluster(), labelled)); !response.Allowed {
+		t.Fatalf("expected the edit of other fields to be allowed, got %v", response.Result)
+	}
+
+	// Resources not generated by the operator aren't protected
+	userCreated := newVerrazzanoManagedCluster()
+	userCreated.Labels = nil
+	userEdited := userCreated.DeepCopy()
+	userEdited.Spec.ServerAddress = "10.0.0.2:6443"
+	if response = validator.Validate(newUpdateRequest(t, "kubernetes-admin", userCreated, userEdited)); !response.Allowed {
+		t.Fatalf("expected the edit of a user created resource to be allowed, got %v", response.Result)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	edited := newVerrazzanoManagedCluster()
+	edited.Spec.KubeconfigSecret = "other"
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request:  newUpdateRequest(t, "kubernetes-admin", newVerrazzanoManagedCluster(), edited),
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	(&Validator{OperatorUser: constants.OperatorUser}).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, bytes.NewReader(body)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	result := admissionv1.AdmissionReview{}
+	if err = json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != "AdmissionReview" || result.Response == nil || result.Response.UID != "uid" || result.Response.Allowed {
+		t.Fatalf("expected a denying AdmissionReview response, got %v", result)
+	}
+
+	recorder = httptest.NewRecorder()
+	(&Validator{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, ValidatePath, strings.NewReader("{}")))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for a review without a request, got %d", recorder.Code)
+	}
+}
+
+func TestGenerateCertificates(t *testing.T) {
+	certificates, err := GenerateCertificates("webhook", "default", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(certificates.CABundle) {
+		t.Fatalf("expected a PEM encoded CA bundle")
+	}
+	serving, err := x509.ParseCertificate(certificates.Serving.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = serving.Verify(x509.VerifyOptions{DNSName: "webhook.default.svc", Roots: roots}); err != nil {
+		t.Fatalf("expected the serving certificate to be valid for the service, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	server, err := NewServer(Config{Port: 9443, ServiceName: "webhook", ServiceNamespace: "default", OperatorUser: constants.OperatorUser})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kubeClientSet := fake.NewSimpleClientset()
+	var patches []k8stesting.PatchAction
+	kubeClientSet.PrependReactor("patch", "validatingwebhookconfigurations", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches = append(patches, action.(k8stesting.PatchAction))
+		return true, nil, nil
+	})
+	if err = server.Register(kubeClientSet); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(patches) != 1 || patches[0].GetPatchType() != types.ApplyPatchType {
+		t.Fatalf("expected a single apply patch, got %v", kubeClientSet.Actions())
+	}
+	configuration := admissionregistrationv1.ValidatingWebhookConfiguration{}
+	if err = json.Unmarshal(patches[0].GetPatch(), &configuration); err != nil {
+		t.Fatal(err)
+	}
+	webhook := configuration.Webhooks[0]
+	if !bytes.Equal(webhook.ClientConfig.CABundle, server.certificates.CABundle) || webhook.ClientConfig.Service.Name != "webhook" || *webhook.ClientConfig.Service.Path != ValidatePath {
+		t.Fatalf("unexpected webhook client config %v", webhook.ClientConfig)
+	}
+	if *webhook.FailurePolicy != admissionregistrationv1.Ignore || webhook.Rules[0].Operations[0] != admissionregistrationv1.Update {
+		t.Fatalf("unexpected webhook %v", webhook)
+	}
+}
+
+func TestStart(t *testing.T) {
+	server, err := NewServer(Config{Port: 0, ServiceName: "webhook", ServiceNamespace: "default", OperatorUser: constants.OperatorUser})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	if err = server.Start(stopCh); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The server answers as soon as Start returns
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, Timeout: 5 * time.Second}
+	response, err := client.Get("https://" + server.listener.Addr().String() + ValidatePath)
+	if err != nil {
+		t.Fatalf("expected the webhook to be served, got %v", err)
+	}
+	response.Body.Close()
+
+	// A port that is already taken fails the start instead of leaving the webhook unserved
+	port := server.listener.Addr().(*net.TCPAddr).Port
+	taken, err := NewServer(Config{Port: port, ServiceName: "webhook", ServiceNamespace: "default", OperatorUser: constants.OperatorUser})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = taken.Start(stopCh); err == nil {
+		t.Fatalf("expected an error for a port that is already taken")
+	}
+}